@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+)
+
+// addrEnv names the environment variable that sets the daemon address.
+const addrEnv = "CONNECTTOOL_ADDR"
+
+// An address is a parsed daemon target.
+type address struct {
+	network string // "unix", "tcp" or "npipe"
+	path    string // socket path, host:port, or \\host\pipe\name
+}
+
+// String formats the address in the URL form accepted by parseAddress.
+func (a address) String() string {
+	switch a.network {
+	case "npipe":
+		return "npipe://" + strings.ReplaceAll(a.path, `\`, "/")
+	case "unix":
+		if strings.HasPrefix(a.path, "/") {
+			return "unix://" + a.path
+		}
+		return "unix:" + a.path
+	default:
+		return a.network + "://" + a.path
+	}
+}
+
+// parseAddress parses a daemon address. Accepted forms are
+//
+//	unix:///abs/path.sock, unix:rel/path.sock, /abs/path.sock, C:\dir\x.sock
+//	tcp://127.0.0.1:50051, 127.0.0.1:50051, localhost:50051
+//	npipe:////./pipe/connect_tool
+//
+// A string without a scheme is a TCP host:port if it has a numeric port,
+// and a unix socket path otherwise.
+func parseAddress(s string) (address, error) {
+	if s == "" {
+		return address{}, fmt.Errorf("empty address")
+	}
+	if isDrivePath(s) {
+		return address{network: "unix", path: s}, nil
+	}
+	scheme, rest, hasScheme := strings.Cut(s, ":")
+	switch {
+	case hasScheme && scheme == "unix":
+		path := strings.TrimPrefix(rest, "//")
+		// unix:///C:/dir/x.sock carries a slash before the drive letter.
+		if len(path) > 1 && path[0] == '/' && isDrivePath(path[1:]) {
+			path = path[1:]
+		}
+		if path == "" {
+			return address{}, fmt.Errorf("invalid address %q: missing socket path", s)
+		}
+		return address{network: "unix", path: path}, nil
+	case hasScheme && scheme == "tcp":
+		hostport := strings.TrimPrefix(rest, "//")
+		if _, _, err := splitHostPort(hostport); err != nil {
+			return address{}, fmt.Errorf("invalid address %q: %w", s, err)
+		}
+		return address{network: "tcp", path: hostport}, nil
+	case hasScheme && scheme == "npipe":
+		// npipe:////./pipe/name: the pipe path follows the "//" authority.
+		path := strings.ReplaceAll(strings.TrimPrefix(rest, "//"), "/", `\`)
+		host, name, ok := strings.Cut(strings.TrimPrefix(path, `\\`), `\pipe\`)
+		if !strings.HasPrefix(path, `\\`) || !ok || host == "" || name == "" {
+			return address{}, fmt.Errorf(`invalid address %q: want npipe:////./pipe/<name>`, s)
+		}
+		return address{network: "npipe", path: path}, nil
+	case strings.Contains(s, "://"):
+		return address{}, fmt.Errorf("invalid address %q: unsupported scheme %q (want unix, tcp or npipe)", s, scheme)
+	}
+	if _, _, err := splitHostPort(s); err == nil {
+		return address{network: "tcp", path: s}, nil
+	}
+	return address{network: "unix", path: s}, nil
+}
+
+// isDrivePath reports whether s starts with a Windows drive letter, such as
+// C:\ or C:/, which would otherwise be mistaken for a URL scheme.
+func isDrivePath(s string) bool {
+	if len(s) < 3 || s[1] != ':' || (s[2] != '\\' && s[2] != '/') {
+		return false
+	}
+	c := s[0] | 0x20
+	return c >= 'a' && c <= 'z'
+}
+
+func splitHostPort(hostport string) (host, port string, err error) {
+	host, port, err = net.SplitHostPort(hostport)
+	if err != nil {
+		return "", "", err
+	}
+	if port == "" {
+		return "", "", fmt.Errorf("missing port in address %q", hostport)
+	}
+	for _, c := range port {
+		if c < '0' || c > '9' {
+			return "", "", fmt.Errorf("invalid port %q", port)
+		}
+	}
+	return host, port, nil
+}
+
+// dialTarget returns the gRPC target string and any extra dial options
+// needed to reach the address.
+func (a address) dialTarget() (string, []grpc.DialOption) {
+	switch a.network {
+	case "tcp":
+		return "dns:///" + a.path, nil
+	case "npipe":
+		// grpc-go cannot dial named pipes itself; the dialer ignores the
+		// passthrough target and connects to the pipe directly.
+		path := a.path
+		dialer := func(ctx context.Context, _ string) (net.Conn, error) {
+			return dialPipe(ctx, path)
+		}
+		return "passthrough:///npipe", []grpc.DialOption{grpc.WithContextDialer(dialer)}
+	default:
+		return "unix:" + a.path, nil
+	}
+}
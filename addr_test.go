@@ -0,0 +1,75 @@
+package main
+
+import "testing"
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		in      string
+		network string
+		path    string
+	}{
+		{"unix:///tmp/connect_tool.sock", "unix", "/tmp/connect_tool.sock"},
+		{"unix:connect_tool.sock", "unix", "connect_tool.sock"},
+		{"unix://connect_tool.sock", "unix", "connect_tool.sock"},
+		{"unix:run/connect_tool.sock", "unix", "run/connect_tool.sock"},
+		{"/tmp/connect_tool.sock", "unix", "/tmp/connect_tool.sock"},
+		{"connect_tool.sock", "unix", "connect_tool.sock"},
+		{`C:\Users\me\connect_tool.sock`, "unix", `C:\Users\me\connect_tool.sock`},
+		{"c:/Users/me/connect_tool.sock", "unix", "c:/Users/me/connect_tool.sock"},
+		{"unix:///C:/Users/me/connect_tool.sock", "unix", "C:/Users/me/connect_tool.sock"},
+		{`unix:C:\connect_tool.sock`, "unix", `C:\connect_tool.sock`},
+		{"tcp://127.0.0.1:50051", "tcp", "127.0.0.1:50051"},
+		{"tcp://localhost:50051", "tcp", "localhost:50051"},
+		{"127.0.0.1:50051", "tcp", "127.0.0.1:50051"},
+		{"localhost:50051", "tcp", "localhost:50051"},
+		{"[::1]:50051", "tcp", "[::1]:50051"},
+		{"npipe:////./pipe/connect_tool", "npipe", `\\.\pipe\connect_tool`},
+		{`npipe://\\.\pipe\connect_tool`, "npipe", `\\.\pipe\connect_tool`},
+		{"npipe:////server/pipe/connect_tool", "npipe", `\\server\pipe\connect_tool`},
+	}
+	for _, tt := range tests {
+		got, err := parseAddress(tt.in)
+		if err != nil {
+			t.Errorf("parseAddress(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got.network != tt.network || got.path != tt.path {
+			t.Errorf("parseAddress(%q) = %s %q, want %s %q", tt.in, got.network, got.path, tt.network, tt.path)
+		}
+	}
+}
+
+func TestParseAddressErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"unix:",
+		"unix://",
+		"tcp://127.0.0.1",
+		"tcp://127.0.0.1:",
+		"tcp://localhost:grpc",
+		"npipe://connect_tool",
+		"npipe:////./pipe/",
+		"http://127.0.0.1:50051",
+	} {
+		if got, err := parseAddress(in); err == nil {
+			t.Errorf("parseAddress(%q) = %s %q, want error", in, got.network, got.path)
+		}
+	}
+}
+
+func TestAddressStringRoundTrip(t *testing.T) {
+	for _, in := range []string{
+		"unix:///tmp/connect_tool.sock",
+		"unix:connect_tool.sock",
+		"tcp://127.0.0.1:50051",
+		"npipe:////./pipe/connect_tool",
+	} {
+		a, err := parseAddress(in)
+		if err != nil {
+			t.Fatalf("parseAddress(%q) error: %v", in, err)
+		}
+		if got := a.String(); got != in {
+			t.Errorf("parseAddress(%q).String() = %q", in, got)
+		}
+	}
+}
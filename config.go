@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// settingKeys are the settings the config file, environment and global
+// flags can set, in the order config show lists them.
+var settingKeys = []string{"address", "timeout", "output"}
+
+// settingEnv names the environment variable for each setting.
+var settingEnv = map[string]string{
+	"address": addrEnv,
+	"timeout": "CONNECTTOOL_TIMEOUT",
+	"output":  "CONNECTTOOL_OUTPUT",
+}
+
+// checkSetting validates a raw value for key.
+func checkSetting(key, value string) error {
+	switch key {
+	case "address":
+		_, err := parseAddress(value)
+		return err
+	case "timeout":
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid timeout %q: want a duration such as \"10s\"", value)
+		}
+		if d <= 0 {
+			return fmt.Errorf("timeout must be positive, got %s", d)
+		}
+		return nil
+	case "output":
+		switch value {
+		case outputText, outputJSON:
+			return nil
+		}
+		return fmt.Errorf("unknown output %q (want text or json)", value)
+	}
+	return fmt.Errorf("unknown setting %q (want address, timeout or output)", key)
+}
+
+// configPath returns where the config file lives for goos:
+// %APPDATA%\connecttool\cli.toml on Windows, otherwise
+// $XDG_CONFIG_HOME/connecttool/cli.toml, falling back to ~/.config. It
+// returns "" if the variables it needs are unset.
+func configPath(goos string, getenv func(string) string) string {
+	if goos == "windows" {
+		if dir := getenv("APPDATA"); dir != "" {
+			return strings.TrimRight(dir, `\/`) + `\connecttool\cli.toml`
+		}
+		return ""
+	}
+	dir := getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home := getenv("HOME")
+		if home == "" {
+			return ""
+		}
+		dir = strings.TrimRight(home, "/") + "/.config"
+	}
+	return strings.TrimRight(dir, "/") + "/connecttool/cli.toml"
+}
+
+// A config holds the settings read from the config file. Each table maps
+// setting keys to raw, already validated values.
+type config struct {
+	defaults map[string]string
+	profiles map[string]map[string]string
+}
+
+// loadConfig reads the config file at path. A missing file is not an
+// error and yields a nil config.
+func loadConfig(path string) (*config, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseConfig(path, f)
+}
+
+// parseConfig parses the TOML subset the config file uses: comments,
+// key = "string" pairs at the top level for defaults, and [profiles.<name>]
+// tables of the same keys. Errors are prefixed with name and the line
+// number.
+func parseConfig(name string, r io.Reader) (*config, error) {
+	cfg := &config{defaults: map[string]string{}, profiles: map[string]map[string]string{}}
+	table := cfg.defaults
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		errorf := func(format string, args ...any) error {
+			return fmt.Errorf("%s:%d: %s", name, lineNo, fmt.Sprintf(format, args...))
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			header, rest, ok := strings.Cut(line[1:], "]")
+			if !ok || !isComment(rest) {
+				return nil, errorf("malformed table header")
+			}
+			profile, ok := strings.CutPrefix(strings.TrimSpace(header), "profiles.")
+			if !ok || !isBareKey(profile) {
+				return nil, errorf("unsupported table [%s] (want [profiles.<name>])", strings.TrimSpace(header))
+			}
+			if _, dup := cfg.profiles[profile]; dup {
+				return nil, errorf("profile %q defined twice", profile)
+			}
+			table = map[string]string{}
+			cfg.profiles[profile] = table
+			continue
+		}
+
+		key, rest, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !isBareKey(key) {
+			return nil, errorf("expected key = value")
+		}
+		value, rest, err := parseString(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, errorf("%s: %v", key, err)
+		}
+		if !isComment(rest) {
+			return nil, errorf("%s: unexpected text after value", key)
+		}
+		if _, dup := table[key]; dup {
+			return nil, errorf("%s set twice", key)
+		}
+		if err := checkSetting(key, value); err != nil {
+			return nil, errorf("%v", err)
+		}
+		table[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return cfg, nil
+}
+
+// parseString parses a TOML basic ("...") or literal ('...') string at the
+// start of s and returns it with the rest of s.
+func parseString(s string) (value, rest string, err error) {
+	if s == "" {
+		return "", "", errors.New("missing value")
+	}
+	switch s[0] {
+	case '\'':
+		value, rest, ok := strings.Cut(s[1:], "'")
+		if !ok {
+			return "", "", errors.New("unterminated string")
+		}
+		return value, rest, nil
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			switch c := s[i]; c {
+			case '"':
+				return b.String(), s[i+1:], nil
+			case '\\':
+				i++
+				if i == len(s) {
+					return "", "", errors.New("unterminated string")
+				}
+				switch s[i] {
+				case '"', '\\':
+					b.WriteByte(s[i])
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					return "", "", fmt.Errorf("unsupported escape \\%c", s[i])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", "", errors.New("unterminated string")
+	}
+	return "", "", errors.New("value must be a quoted string")
+}
+
+// isComment reports whether s is empty or only a trailing comment.
+func isComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || s[0] == '#'
+}
+
+func isBareKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// flagSettings maps the global flags given on the command line, by name
+// to value as flag.Visit reports them, to the flag layer of settings.
+// --addr wins over --socket, and an empty --addr counts as not given.
+func flagSettings(visited map[string]string) map[string]string {
+	flags := make(map[string]string)
+	if v := visited["addr"]; v != "" {
+		flags["address"] = v
+	} else if path, ok := visited["socket"]; ok {
+		flags["address"] = address{network: "unix", path: path}.String()
+	}
+	if v, ok := visited["timeout"]; ok {
+		flags["timeout"] = v
+	}
+	for _, name := range []string{"output", "o"} {
+		if v, ok := visited[name]; ok {
+			flags["output"] = v
+		}
+	}
+	return flags
+}
+
+// A setting is an effective value and the layer it came from.
+type setting struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// settings are the effective global settings.
+type settings struct {
+	addr    address
+	timeout time.Duration
+	output  string
+	values  map[string]setting
+}
+
+// resolveSettings layers flags, the environment, the selected profile,
+// the file's defaults and builtin, in that order of precedence. flags and
+// builtin map setting keys to raw values; cfg may be nil if there is no
+// config file at path. The winning value for each key is validated and
+// errors name where it came from.
+func resolveSettings(cfg *config, path, profile string, flags, builtin map[string]string, getenv func(string) string) (settings, error) {
+	if cfg == nil {
+		cfg = &config{}
+	}
+	type layer struct {
+		source func(key string) string
+		values map[string]string
+	}
+	env := make(map[string]string)
+	for key, name := range settingEnv {
+		if v := getenv(name); v != "" {
+			env[key] = v
+		}
+	}
+	layers := []layer{
+		{func(string) string { return "flag" }, flags},
+		{func(key string) string { return "$" + settingEnv[key] }, env},
+	}
+	if profile != "" {
+		values, ok := cfg.profiles[profile]
+		if !ok {
+			where := path
+			if where == "" {
+				where = "the config file"
+			}
+			return settings{}, fmt.Errorf("profile %q is not defined in %s", profile, where)
+		}
+		layers = append(layers, layer{func(string) string { return "profile " + profile }, values})
+	}
+	layers = append(layers,
+		layer{func(string) string { return "file" }, cfg.defaults},
+		layer{func(string) string { return "default" }, builtin},
+	)
+
+	s := settings{values: make(map[string]setting)}
+	for _, key := range settingKeys {
+		for _, l := range layers {
+			if v, ok := l.values[key]; ok {
+				s.values[key] = setting{Value: v, Source: l.source(key)}
+				break
+			}
+		}
+		v := s.values[key]
+		if err := checkSetting(key, v.Value); err != nil {
+			return settings{}, fmt.Errorf("%s (from %s): %w", key, v.Source, err)
+		}
+	}
+	s.addr, _ = parseAddress(s.values["address"].Value)
+	s.timeout, _ = time.ParseDuration(s.values["timeout"].Value)
+	s.output = s.values["output"].Value
+	return s, nil
+}
+
+type configShowResult struct {
+	File      string             `json:"file"`
+	FileFound bool               `json:"file_found"`
+	Profile   string             `json:"profile,omitempty"`
+	Settings  map[string]setting `json:"settings"`
+}
+
+func (r configShowResult) writeText(w io.Writer) {
+	file := r.File
+	switch {
+	case file == "":
+		file = "(no location)"
+	case !r.FileFound:
+		file += " (not found)"
+	}
+	fmt.Fprintf(w, "Config file: %s\n", file)
+	if r.Profile != "" {
+		fmt.Fprintf(w, "Profile: %s\n", r.Profile)
+	}
+	for _, key := range settingKeys {
+		v := r.Settings[key]
+		fmt.Fprintf(w, "%s = %s (%s)\n", key, v.Value, v.Source)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestConfigPath(t *testing.T) {
+	tests := []struct {
+		goos string
+		vars map[string]string
+		want string
+	}{
+		{"linux", map[string]string{"XDG_CONFIG_HOME": "/xdg", "HOME": "/home/me"}, "/xdg/connecttool/cli.toml"},
+		{"linux", map[string]string{"XDG_CONFIG_HOME": "/xdg/"}, "/xdg/connecttool/cli.toml"},
+		{"linux", map[string]string{"HOME": "/home/me"}, "/home/me/.config/connecttool/cli.toml"},
+		{"darwin", map[string]string{"HOME": "/Users/me"}, "/Users/me/.config/connecttool/cli.toml"},
+		{"linux", nil, ""},
+		{"windows", map[string]string{"APPDATA": `C:\Users\me\AppData\Roaming`}, `C:\Users\me\AppData\Roaming\connecttool\cli.toml`},
+		{"windows", map[string]string{"APPDATA": `C:\Roaming\`}, `C:\Roaming\connecttool\cli.toml`},
+		{"windows", map[string]string{"XDG_CONFIG_HOME": "/xdg", "HOME": "/home/me"}, ""},
+	}
+	for _, tt := range tests {
+		if got := configPath(tt.goos, env(tt.vars)); got != tt.want {
+			t.Errorf("configPath(%s, %v) = %q, want %q", tt.goos, tt.vars, got, tt.want)
+		}
+	}
+}
+
+const testConfig = `# defaults
+address = "unix:///run/main.sock"
+timeout = '10s' # literal string
+
+[profiles.alt]
+address = "/run/alt.sock"
+output = "json"
+
+[profiles.tcp]
+address = "tcp://127.0.0.1:50051"
+`
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := parseConfig("cli.toml", strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.defaults["address"]; got != "unix:///run/main.sock" {
+		t.Errorf("default address = %q", got)
+	}
+	if got := cfg.defaults["timeout"]; got != "10s" {
+		t.Errorf("default timeout = %q", got)
+	}
+	if got := cfg.profiles["alt"]["output"]; got != "json" {
+		t.Errorf("alt output = %q", got)
+	}
+	if len(cfg.profiles) != 2 {
+		t.Errorf("profiles = %v, want alt and tcp", cfg.profiles)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"address = /run/x.sock", "cli.toml:1: address: value must be a quoted string"},
+		{"\n\naddress = \"/run/x.sock", "cli.toml:3: address: unterminated string"},
+		{"timeout = \"soon\"", "cli.toml:1: invalid timeout"},
+		{"output = \"yaml\"", "cli.toml:1: unknown output"},
+		{"socket = \"/run/x.sock\"", "cli.toml:1: unknown setting"},
+		{"[profile.alt]", "cli.toml:1: unsupported table [profile.alt]"},
+		{"[profiles.alt]\n[profiles.alt]", "cli.toml:2: profile \"alt\" defined twice"},
+		{"output = \"json\"\noutput = \"text\"", "cli.toml:2: output set twice"},
+		{"output = \"json\" extra", "cli.toml:1: output: unexpected text after value"},
+		{"just words", "cli.toml:1: expected key = value"},
+	}
+	for _, tt := range tests {
+		_, err := parseConfig("cli.toml", strings.NewReader(tt.in))
+		if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("parseConfig(%q) error = %v, want prefix %q", tt.in, err, tt.want)
+		}
+	}
+}
+
+var testBuiltin = map[string]string{
+	"address": "unix:///tmp/connect_tool.sock",
+	"timeout": "5s",
+	"output":  "text",
+}
+
+func TestResolveSettingsPrecedence(t *testing.T) {
+	cfg, err := parseConfig("cli.toml", strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		profile string
+		flags   map[string]string
+		vars    map[string]string
+		key     string
+		value   string
+		source  string
+	}{
+		{"builtin", "", nil, nil, "output", "text", "default"},
+		{"file beats builtin", "", nil, nil, "timeout", "10s", "file"},
+		{"profile beats file", "alt", nil, nil, "address", "/run/alt.sock", "profile alt"},
+		{"file still fills profile gaps", "alt", nil, nil, "timeout", "10s", "file"},
+		{"env beats profile", "alt", nil, map[string]string{addrEnv: "tcp://10.0.0.1:1"}, "address", "tcp://10.0.0.1:1", "$" + addrEnv},
+		{"flag beats env", "alt", map[string]string{"address": "/flag.sock"}, map[string]string{addrEnv: "tcp://10.0.0.1:1"}, "address", "/flag.sock", "flag"},
+		{"env output", "", nil, map[string]string{"CONNECTTOOL_OUTPUT": "json"}, "output", "json", "$CONNECTTOOL_OUTPUT"},
+		{"flag output", "alt", map[string]string{"output": "text"}, nil, "output", "text", "flag"},
+	}
+	for _, tt := range tests {
+		s, err := resolveSettings(cfg, "cli.toml", tt.profile, tt.flags, testBuiltin, env(tt.vars))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := s.values[tt.key]; got.Value != tt.value || got.Source != tt.source {
+			t.Errorf("%s: %s = %q from %s, want %q from %s", tt.name, tt.key, got.Value, got.Source, tt.value, tt.source)
+		}
+	}
+}
+
+func TestResolveSettingsTyped(t *testing.T) {
+	cfg, err := parseConfig("cli.toml", strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := resolveSettings(cfg, "cli.toml", "tcp", nil, testBuiltin, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.addr.network != "tcp" || s.addr.path != "127.0.0.1:50051" {
+		t.Errorf("addr = %v", s.addr)
+	}
+	if s.timeout.String() != "10s" {
+		t.Errorf("timeout = %s", s.timeout)
+	}
+	if s.output != outputText {
+		t.Errorf("output = %s", s.output)
+	}
+}
+
+func TestResolveSettingsNoFile(t *testing.T) {
+	s, err := resolveSettings(nil, "", "", nil, testBuiltin, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range testBuiltin {
+		if got := s.values[key]; got.Value != want || got.Source != "default" {
+			t.Errorf("%s = %q from %s, want builtin %q", key, got.Value, got.Source, want)
+		}
+	}
+	if _, err := resolveSettings(nil, "/missing/cli.toml", "alt", nil, testBuiltin, env(nil)); err == nil {
+		t.Error("selecting a profile without a config file should be an error")
+	}
+}
+
+func TestResolveSettingsErrors(t *testing.T) {
+	cfg, err := parseConfig("cli.toml", strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolveSettings(cfg, "cli.toml", "nope", nil, testBuiltin, env(nil)); err == nil {
+		t.Error("unknown profile should be an error")
+	}
+	_, err = resolveSettings(cfg, "cli.toml", "", nil, testBuiltin, env(map[string]string{addrEnv: "bogus://x"}))
+	if err == nil || !strings.Contains(err.Error(), "$"+addrEnv) {
+		t.Errorf("invalid $%s error = %v, want it named", addrEnv, err)
+	}
+	for _, bad := range []string{"yaml", "compact-json"} {
+		_, err = resolveSettings(cfg, "cli.toml", "alt", map[string]string{"output": bad}, testBuiltin, env(nil))
+		if err == nil || !strings.Contains(err.Error(), "flag") {
+			t.Errorf("--output %s error = %v, want it rejected and attributed to the flag", bad, err)
+		}
+	}
+	_, err = resolveSettings(cfg, "cli.toml", "", map[string]string{"timeout": "0s"}, testBuiltin, env(nil))
+	if err == nil || !strings.Contains(err.Error(), "flag") {
+		t.Errorf("zero --timeout error = %v, want it attributed to the flag", err)
+	}
+}
+
+func TestFlagSettings(t *testing.T) {
+	tests := []struct {
+		visited map[string]string
+		want    map[string]string
+	}{
+		{nil, map[string]string{}},
+		{map[string]string{"addr": "tcp://127.0.0.1:50051", "socket": "/socket.sock"}, map[string]string{"address": "tcp://127.0.0.1:50051"}},
+		{map[string]string{"socket": "/socket.sock"}, map[string]string{"address": "unix:///socket.sock"}},
+		{map[string]string{"addr": "", "socket": "connect_tool.sock"}, map[string]string{"address": "unix:connect_tool.sock"}},
+		{map[string]string{"timeout": "2s", "o": "yaml"}, map[string]string{"timeout": "2s", "output": "yaml"}},
+		{map[string]string{"output": "compact-json"}, map[string]string{"output": "compact-json"}},
+	}
+	for _, tt := range tests {
+		if got := flagSettings(tt.visited); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("flagSettings(%v) = %v, want %v", tt.visited, got, tt.want)
+		}
+	}
+}
+
+func TestAddressPrecedence(t *testing.T) {
+	tests := []struct {
+		name    string
+		visited map[string]string
+		envAddr string
+		network string
+		path    string
+		source  string
+	}{
+		{"--addr beats --socket", map[string]string{"addr": "unix:///flag.sock", "socket": "/socket.sock"}, "tcp://127.0.0.1:50051", "unix", "/flag.sock", "flag"},
+		{"explicit --socket beats env", map[string]string{"socket": "/socket.sock"}, "tcp://127.0.0.1:50051", "unix", "/socket.sock", "flag"},
+		{"env beats default socket", nil, "tcp://127.0.0.1:50051", "tcp", "127.0.0.1:50051", "$" + addrEnv},
+		{"default socket", nil, "", "unix", "/tmp/connect_tool.sock", "default"},
+	}
+	for _, tt := range tests {
+		vars := map[string]string{addrEnv: tt.envAddr}
+		s, err := resolveSettings(nil, "", "", flagSettings(tt.visited), testBuiltin, env(vars))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if s.addr.network != tt.network || s.addr.path != tt.path || s.values["address"].Source != tt.source {
+			t.Errorf("%s: got %s %q from %s, want %s %q from %s", tt.name, s.addr.network, s.addr.path, s.values["address"].Source, tt.network, tt.path, tt.source)
+		}
+	}
+
+	vars := map[string]string{addrEnv: "bogus://x"}
+	if _, err := resolveSettings(nil, "", "", flagSettings(nil), testBuiltin, env(vars)); err == nil {
+		t.Errorf("invalid $%s should be an error", addrEnv)
+	}
+}
+
+func TestBadOutputFlagRejected(t *testing.T) {
+	for _, bad := range []string{"yaml", "compact-json"} {
+		flags := flagSettings(map[string]string{"output": bad, "o": bad})
+		if _, err := resolveSettings(nil, "", "", flags, testBuiltin, env(nil)); err == nil {
+			t.Errorf("--output %s was accepted", bad)
+		}
+	}
+}
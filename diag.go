@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// diagMemberJSON is a lobby member with the VPN route matched to it by
+// name.
+type diagMemberJSON struct {
+	lobbyMemberJSON
+	VPNIP string `json:"vpn_ip,omitempty"`
+	Issue string `json:"issue,omitempty"`
+}
+
+type diagLobbyJSON struct {
+	InLobby bool             `json:"in_lobby"`
+	LobbyID string           `json:"lobby_id,omitempty"`
+	Members []diagMemberJSON `json:"members"`
+}
+
+// diagResult correlates lobby info, VPN status and the routing table. A
+// section is nil when its RPC failed; the failure is listed in Problems.
+type diagResult struct {
+	VPN         *vpnStatusResult `json:"vpn"`
+	Lobby       *diagLobbyJSON   `json:"lobby"`
+	StaleRoutes []routeJSON      `json:"stale_routes"`
+	Problems    []string         `json:"problems"`
+}
+
+func (r diagResult) succeeded() bool { return len(r.Problems) == 0 }
+
+func (r diagResult) writeText(w io.Writer) {
+	fmt.Fprintln(w, "Local VPN:")
+	if vpn := r.VPN; vpn != nil {
+		fmt.Fprintf(w, "  Enabled: %v\n", vpn.Enabled)
+		if vpn.Enabled {
+			fmt.Fprintf(w, "  Local IP: %s\n", vpn.LocalIP)
+			fmt.Fprintf(w, "  Device: %s\n", vpn.DeviceName)
+		}
+		if stats := vpn.Stats; stats != nil {
+			dropped := fmt.Sprintf("  Dropped: %d pkts", stats.PacketsDropped)
+			if stats.PacketsDropped > 0 {
+				dropped += " [!] packets dropped"
+			}
+			fmt.Fprintln(w, dropped)
+		}
+	} else {
+		fmt.Fprintln(w, "  [!] unavailable")
+	}
+
+	switch lobby := r.Lobby; {
+	case lobby == nil:
+		fmt.Fprintln(w, "Lobby: [!] unavailable")
+	case !lobby.InLobby:
+		fmt.Fprintln(w, "In Lobby: false")
+	default:
+		fmt.Fprintf(w, "Lobby ID: %s\n", lobby.LobbyID)
+		fmt.Fprintln(w, "Members:")
+		for _, m := range lobby.Members {
+			line := fmt.Sprintf("  - Name: %s, ID: %s, Ping: %d, Relay: %s", m.Name, m.SteamID, m.Ping, m.RelayInfo)
+			if m.VPNIP != "" {
+				line += ", VPN IP: " + m.VPNIP
+			}
+			if m.Issue != "" {
+				line += " [!] " + m.Issue
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+
+	if len(r.StaleRoutes) > 0 {
+		fmt.Fprintln(w, "Stale routes:")
+		for _, route := range r.StaleRoutes {
+			fmt.Fprintf(w, "  - IP: %s, Name: %s [!] no lobby member with this name\n", route.IP, route.Name)
+		}
+	}
+
+	switch n := len(r.Problems); n {
+	case 0:
+		fmt.Fprintln(w, "No problems found.")
+	case 1:
+		fmt.Fprintln(w, "1 problem found:")
+	default:
+		fmt.Fprintf(w, "%d problems found:\n", n)
+	}
+	for _, p := range r.Problems {
+		fmt.Fprintf(w, "  - %s\n", p)
+	}
+}
+
+// diagnose queries lobby info, VPN status and the routing table
+// concurrently and reports on them together. A failed RPC is noted in the
+// report rather than aborting it; only when all three fail is the error
+// returned, since then there is nothing to report.
+func diagnose(ctx context.Context, client ConnectToolServiceClient) (result, error) {
+	var (
+		wg                           sync.WaitGroup
+		info, status, table          result
+		infoErr, statusErr, tableErr error
+	)
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		info, infoErr = getLobbyInfo(ctx, client, infoOptions{})
+	}()
+	go func() {
+		defer wg.Done()
+		status, statusErr = getVPNStatus(ctx, client, false)
+	}()
+	go func() {
+		defer wg.Done()
+		table, tableErr = getVPNRoutingTable(ctx, client, routeListOptions{})
+	}()
+	wg.Wait()
+
+	if infoErr != nil && statusErr != nil && tableErr != nil {
+		return nil, infoErr
+	}
+	var r diagResult
+	var lobby *lobbyInfoResult
+	var vpn *vpnStatusResult
+	var routes []routeJSON
+	if infoErr != nil {
+		r.Problems = append(r.Problems, infoErr.Error())
+	} else {
+		info := info.(lobbyInfoResult)
+		lobby = &info
+	}
+	if statusErr != nil {
+		r.Problems = append(r.Problems, statusErr.Error())
+	} else {
+		status := status.(vpnStatusResult)
+		vpn = &status
+	}
+	if tableErr != nil {
+		r.Problems = append(r.Problems, tableErr.Error())
+	} else {
+		routes = table.(routingTableResult).Routes
+	}
+	correlate(&r, lobby, vpn, routes)
+	return r, nil
+}
+
+// correlate fills in r from whichever of lobby, vpn and routes were
+// fetched. A nil routes means the table is unknown, so members are not
+// flagged for lacking a route. Routes are matched to members by name; the
+// local route describes this machine and is never stale.
+func correlate(r *diagResult, lobby *lobbyInfoResult, vpn *vpnStatusResult, routes []routeJSON) {
+	r.VPN = vpn
+	r.StaleRoutes = []routeJSON{}
+	if r.Problems == nil {
+		r.Problems = []string{}
+	}
+	if vpn != nil {
+		if stats := vpn.Stats; stats != nil && stats.PacketsDropped > 0 {
+			r.Problems = append(r.Problems, fmt.Sprintf("%d packets dropped", stats.PacketsDropped))
+		}
+		if !vpn.Enabled && lobby != nil && lobby.InLobby {
+			r.Problems = append(r.Problems, "VPN is disabled while in a lobby")
+		}
+	}
+
+	routeByName := make(map[string]routeJSON)
+	for _, route := range routes {
+		if _, dup := routeByName[route.Name]; !dup {
+			routeByName[route.Name] = route
+		}
+	}
+
+	members := make(map[string]bool)
+	if lobby != nil {
+		r.Lobby = &diagLobbyJSON{InLobby: lobby.InLobby, LobbyID: lobby.LobbyID, Members: []diagMemberJSON{}}
+		for _, m := range lobby.Members {
+			members[m.Name] = true
+			dm := diagMemberJSON{lobbyMemberJSON: m}
+			if route, ok := routeByName[m.Name]; ok {
+				dm.VPNIP = route.IP
+			} else if routes != nil {
+				dm.Issue = "no VPN route"
+				r.Problems = append(r.Problems, fmt.Sprintf("%s (%s) has no VPN route", m.Name, m.SteamID))
+			}
+			r.Lobby.Members = append(r.Lobby.Members, dm)
+		}
+	}
+
+	// Without the member list every peer route would look stale.
+	if lobby == nil {
+		return
+	}
+	for _, route := range routes {
+		if route.IsLocal || members[route.Name] {
+			continue
+		}
+		r.StaleRoutes = append(r.StaleRoutes, route)
+		r.Problems = append(r.Problems, fmt.Sprintf("stale route %s for %s matches no lobby member", route.IP, route.Name))
+	}
+}
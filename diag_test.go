@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+func TestCorrelate(t *testing.T) {
+	lobby := &lobbyInfoResult{InLobby: true, LobbyID: "1", Members: []lobbyMemberJSON{
+		{Name: "Me", SteamID: "1"},
+		{Name: "Alex", SteamID: "2"},
+		{Name: "Bo", SteamID: "3"},
+	}}
+	vpn := &vpnStatusResult{Enabled: true, Stats: &vpnStatsJSON{PacketsDropped: 0}}
+	routes := []routeJSON{
+		{IP: "10.0.0.1", Name: "Me", IsLocal: true},
+		{IP: "10.0.0.2", Name: "Alex"},
+		{IP: "10.0.1.5", Name: "Ghost"},
+	}
+
+	var r diagResult
+	correlate(&r, lobby, vpn, routes)
+	if got := r.Lobby.Members[1].VPNIP; got != "10.0.0.2" {
+		t.Errorf("Alex VPN IP = %q, want 10.0.0.2", got)
+	}
+	if got := r.Lobby.Members[2].Issue; got != "no VPN route" {
+		t.Errorf("Bo issue = %q, want no VPN route", got)
+	}
+	if len(r.StaleRoutes) != 1 || r.StaleRoutes[0].Name != "Ghost" {
+		t.Errorf("stale routes = %v, want only Ghost", r.StaleRoutes)
+	}
+	if len(r.Problems) != 2 || r.succeeded() {
+		t.Errorf("problems = %q, want 2", r.Problems)
+	}
+}
+
+func TestCorrelateVPNDisabledInLobby(t *testing.T) {
+	lobby := &lobbyInfoResult{InLobby: true, Members: []lobbyMemberJSON{{Name: "Me"}}}
+
+	var r diagResult
+	correlate(&r, lobby, &vpnStatusResult{Enabled: false}, []routeJSON{{Name: "Me", IsLocal: true}})
+	if len(r.Problems) != 1 || r.Problems[0] != "VPN is disabled while in a lobby" {
+		t.Errorf("problems = %q, want VPN disabled", r.Problems)
+	}
+}
+
+func TestCorrelateUnknownRoutes(t *testing.T) {
+	lobby := &lobbyInfoResult{InLobby: true, Members: []lobbyMemberJSON{{Name: "Me"}, {Name: "Alex"}}}
+
+	r := diagResult{Problems: []string{"could not get VPN routing table"}}
+	correlate(&r, lobby, &vpnStatusResult{Enabled: true}, nil)
+	for _, m := range r.Lobby.Members {
+		if m.Issue != "" {
+			t.Errorf("%s flagged %q with no routing table", m.Name, m.Issue)
+		}
+	}
+	if len(r.Problems) != 1 {
+		t.Errorf("problems = %q, want only the RPC failure", r.Problems)
+	}
+}
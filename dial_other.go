@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+func dialPipe(ctx context.Context, path string) (net.Conn, error) {
+	return nil, fmt.Errorf("named pipe %s: named pipes are only supported on Windows", path)
+}
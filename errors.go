@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Exit codes. They are part of the CLI's interface and listed in the usage
+// text, so scripts can tell a dead daemon from a rejected operation.
+const (
+	exitOK          = 0 // command succeeded
+	exitUsage       = 1 // bad command line
+	exitUnreachable = 2 // daemon unreachable or connection failed
+	exitFailed      = 3 // RPC completed but the operation failed
+)
+
+// exitError attaches an exit code to an error.
+type exitError struct {
+	code     int
+	err      error
+	reported bool // already printed to stderr
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+func usageErrorf(format string, args ...any) error {
+	return &exitError{code: exitUsage, err: fmt.Errorf(format, args...)}
+}
+
+// flagError wraps an error from parsing a flag set. The flag package has
+// already printed it along with the usage, so fail does not repeat it in
+// text mode.
+func flagError(err error) error {
+	return &exitError{code: exitUsage, err: err, reported: true}
+}
+
+// errNotInLobby is returned by commands that need a lobby to report on.
+var errNotInLobby = &exitError{code: exitFailed, err: errors.New("not in a lobby")}
+
+// An operationResult describes an RPC whose response carries its own
+// success flag. A result reporting failure still renders normally, but the
+// process exits with exitFailed.
+type operationResult interface {
+	result
+	succeeded() bool
+}
+
+// exitCode maps an error returned by a command to the process exit code.
+func exitCode(err error) int {
+	var e *exitError
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &e):
+		return e.code
+	case status.Code(err) == codes.Unavailable:
+		return exitUnreachable
+	default:
+		return exitFailed
+	}
+}
+
+// unreachableError replaces the raw Unavailable status, which only shows
+// up as a transport error, with a message naming the daemon address.
+func unreachableError(err error, target string) error {
+	if status.Code(err) != codes.Unavailable {
+		return err
+	}
+	return &exitError{
+		code: exitUnreachable,
+		err:  fmt.Errorf("cannot reach ConnectTool daemon at %s (is it running?)", target),
+	}
+}
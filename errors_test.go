@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestExitCode(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, exitOK},
+		{"help", flag.ErrHelp, exitOK},
+		{"wrapped help", fmt.Errorf("parsing: %w", flag.ErrHelp), exitOK},
+		{"usage", usageErrorf("usage: join <lobby_id>"), exitUsage},
+		{"flag error", flagError(errors.New("bad flag")), exitUsage},
+		{"unavailable", unavailable, exitUnreachable},
+		{"wrapped unavailable", fmt.Errorf("could not get lobby info: %w", unavailable), exitUnreachable},
+		{"unreachable error", unreachableError(unavailable, "unix:///tmp/connect_tool.sock"), exitUnreachable},
+		{"not in lobby", errNotInLobby, exitFailed},
+		{"other status", status.Error(codes.Internal, "boom"), exitFailed},
+		{"plain", errors.New("boom"), exitFailed},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%s) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUnreachableError(t *testing.T) {
+	for _, err := range []error{
+		errors.New("boom"),
+		status.Error(codes.DeadlineExceeded, "slow"),
+		usageErrorf("usage: join <lobby_id>"),
+	} {
+		if got := unreachableError(err, "unix:///tmp/connect_tool.sock"); got != err {
+			t.Errorf("unreachableError(%v) = %v, want it unchanged", err, got)
+		}
+	}
+
+	err := unreachableError(fmt.Errorf("could not join lobby: %w", status.Error(codes.Unavailable, "refused")), "tcp://127.0.0.1:50051")
+	want := "cannot reach ConnectTool daemon at tcp://127.0.0.1:50051 (is it running?)"
+	if err == nil || err.Error() != want {
+		t.Errorf("unreachableError(Unavailable) = %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ambiguousFriendError lists the friends a query could refer to.
+type ambiguousFriendError struct {
+	query      string
+	candidates []*FriendLobby
+}
+
+func (e *ambiguousFriendError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%q matches more than one friend, use a steam ID instead:", e.query)
+	for _, c := range e.candidates {
+		fmt.Fprintf(&b, "\n  %s (%s)", c.GetName(), c.GetSteamId())
+	}
+	return b.String()
+}
+
+// resolveFriend finds the friend a query refers to among lobbies, as
+// returned by GetFriendLobbies. An exact steam ID wins, then a
+// case-insensitive exact name, then a unique case-insensitive name prefix.
+// More than one match at the deciding step is an *ambiguousFriendError.
+func resolveFriend(lobbies []*FriendLobby, query string) (*FriendLobby, error) {
+	for _, l := range lobbies {
+		if l.GetSteamId() == query {
+			return l, nil
+		}
+	}
+	q := strings.ToLower(query)
+	var exact, prefix []*FriendLobby
+	for _, l := range lobbies {
+		name := strings.ToLower(l.GetName())
+		if name == q {
+			exact = append(exact, l)
+		}
+		if strings.HasPrefix(name, q) {
+			prefix = append(prefix, l)
+		}
+	}
+	for _, matches := range [][]*FriendLobby{exact, prefix} {
+		switch len(matches) {
+		case 0:
+			continue
+		case 1:
+			return matches[0], nil
+		default:
+			return nil, &exitError{code: exitFailed, err: &ambiguousFriendError{query: query, candidates: matches}}
+		}
+	}
+	return nil, &exitError{code: exitFailed, err: fmt.Errorf("no friend matching %q is currently in a lobby", query)}
+}
+
+// isSteamID reports whether s looks like a numeric steam ID rather than a
+// friend name.
+func isSteamID(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func findFriend(ctx context.Context, client ConnectToolServiceClient, query string) (*FriendLobby, error) {
+	r, err := client.GetFriendLobbies(ctx, &GetFriendLobbiesRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("could not get friend lobbies: %w", err)
+	}
+	return resolveFriend(r.GetLobbies(), query)
+}
+
+type joinFriendResult struct {
+	joinResult
+	Friend friendLobbyJSON `json:"friend"`
+}
+
+func (r joinFriendResult) writeText(w io.Writer) {
+	fmt.Fprintf(w, "Friend: %s (%s), Lobby: %s\n", r.Friend.Name, r.Friend.SteamID, r.Friend.LobbyID)
+	r.joinResult.writeText(w)
+}
+
+// joinFriend joins the lobby of the friend matching query. Unless yes is
+// set it asks for confirmation first.
+func joinFriend(ctx context.Context, client ConnectToolServiceClient, query string, yes bool) (result, error) {
+	friend, err := findFriend(ctx, client, query)
+	if err != nil {
+		return nil, err
+	}
+	if !yes && !confirm(ctx, fmt.Sprintf("Join %s's lobby %s?", friend.GetName(), friend.GetLobbyId())) {
+		return nil, &exitError{code: exitFailed, err: fmt.Errorf("join cancelled")}
+	}
+	res, err := joinLobby(ctx, client, friend.GetLobbyId())
+	if err != nil {
+		return nil, err
+	}
+	return joinFriendResult{
+		joinResult: res.(joinResult),
+		Friend:     friendLobbyJSON{Name: friend.GetName(), SteamID: friend.GetSteamId(), LobbyID: friend.GetLobbyId()},
+	}, nil
+}
+
+// confirm asks a yes/no question on stderr and reads the answer from
+// stdin. Anything but y or yes, including EOF or ctx being cancelled, is a
+// no.
+func confirm(ctx context.Context, prompt string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", prompt)
+	select {
+	case <-ctx.Done():
+		fmt.Fprintln(os.Stderr)
+		return false
+	case line := <-stdinLines():
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes":
+			return true
+		}
+		return false
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResolveFriend(t *testing.T) {
+	lobbies := []*FriendLobby{
+		{SteamId: "76561190000000001", Name: "Alex", LobbyId: "1"},
+		{SteamId: "76561190000000002", Name: "Alexis", LobbyId: "2"},
+		{SteamId: "76561190000000003", Name: "Dana", LobbyId: "3"},
+		{SteamId: "76561190000000004", Name: "dana smith", LobbyId: "4"},
+	}
+	tests := []struct {
+		query string
+		want  string // steam ID
+	}{
+		{"76561190000000002", "76561190000000002"},
+		{"alex", "76561190000000001"},   // exact name beats prefix of Alexis
+		{"ALEXI", "76561190000000002"},  // unique prefix
+		{"Dana", "76561190000000003"},   // exact beats prefix of "dana smith"
+		{"dana s", "76561190000000004"}, // prefix may contain spaces
+	}
+	for _, tt := range tests {
+		got, err := resolveFriend(lobbies, tt.query)
+		if err != nil {
+			t.Errorf("resolveFriend(%q) error: %v", tt.query, err)
+			continue
+		}
+		if got.GetSteamId() != tt.want {
+			t.Errorf("resolveFriend(%q) = %s, want %s", tt.query, got.GetSteamId(), tt.want)
+		}
+	}
+}
+
+func TestResolveFriendAmbiguous(t *testing.T) {
+	lobbies := []*FriendLobby{
+		{SteamId: "76561190000000001", Name: "Alex", LobbyId: "1"},
+		{SteamId: "76561190000000002", Name: "alex", LobbyId: "2"},
+		{SteamId: "76561190000000003", Name: "Alexis", LobbyId: "3"},
+		{SteamId: "76561190000000004", Name: "Bob", LobbyId: "4"},
+		{SteamId: "76561190000000005", Name: "Bobby", LobbyId: "5"},
+	}
+	for query, n := range map[string]int{"alex": 2, "bo": 2, "al": 3} {
+		_, err := resolveFriend(lobbies, query)
+		var amb *ambiguousFriendError
+		if !errors.As(err, &amb) {
+			t.Errorf("resolveFriend(%q) error = %v, want ambiguous", query, err)
+			continue
+		}
+		if len(amb.candidates) != n {
+			t.Errorf("resolveFriend(%q) has %d candidates, want %d", query, len(amb.candidates), n)
+		}
+		if exitCode(err) != exitFailed {
+			t.Errorf("resolveFriend(%q) exit code = %d, want %d", query, exitCode(err), exitFailed)
+		}
+	}
+}
+
+func TestResolveFriendNotFound(t *testing.T) {
+	lobbies := []*FriendLobby{{SteamId: "76561190000000001", Name: "Alex", LobbyId: "1"}}
+	for _, query := range []string{"zed", "76561190000000009", "lex"} {
+		if got, err := resolveFriend(lobbies, query); err == nil {
+			t.Errorf("resolveFriend(%q) = %s, want error", query, got.GetSteamId())
+		}
+	}
+	if _, err := resolveFriend(nil, "alex"); err == nil {
+		t.Error("resolveFriend with no lobbies should fail")
+	}
+}
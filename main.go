@@ -2,11 +2,18 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"net"
 	"os"
+	"os/signal"
 	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"google.golang.org/grpc"
@@ -15,63 +22,257 @@ import (
 
 func main() {
 	// Define flags
-	socketPath := flag.String("socket", defaultSocketPath(), "Path to the Unix Domain Socket")
-	flag.Parse()
+	flag.String("addr", "", "Daemon address: unix:///path, tcp://host:port or npipe:////./pipe/name (default $"+addrEnv+", the config file or --socket)")
+	flag.String("socket", defaultSocketPath(), "Path to the Unix Domain Socket (shorthand for --addr unix:<path>)")
+	outputFlag := flag.String("output", outputText, "Output format: text or json")
+	flag.StringVar(outputFlag, "o", outputText, "Shorthand for --output")
+	flag.Duration("timeout", rpcTimeout, "Timeout for each RPC attempt")
+	var retry retryPolicy
+	flag.DurationVar(&retry.wait, "wait", 0, "Keep retrying while the daemon is unreachable for up to this long")
+	flag.IntVar(&retry.retries, "retry", 0, "Retry up to this many times while the daemon is unreachable")
+	profile := flag.String("profile", "", "Use the named profile from the config file")
+	builtin := map[string]string{
+		"address": address{network: "unix", path: defaultSocketPath()}.String(),
+		"timeout": rpcTimeout.String(),
+		"output":  outputText,
+	}
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	flag.Usage = printUsage
+	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+		fail(outputText, flagError(err))
+	}
 
 	if len(flag.Args()) < 1 {
 		printUsage()
-		os.Exit(1)
+		os.Exit(exitUsage)
+	}
+	// Until the settings are resolved, errors honour an explicit -o json.
+	// The flag itself is validated with the other settings.
+	errOutput := outputText
+	if *outputFlag == outputJSON {
+		errOutput = outputJSON
+	}
+	switch {
+	case retry.wait < 0:
+		fail(errOutput, usageErrorf("--wait must not be negative, got %s", retry.wait))
+	case retry.retries < 0:
+		fail(errOutput, usageErrorf("--retry must not be negative, got %d", retry.retries))
+	}
+
+	visited := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		visited[f.Name] = f.Value.String()
+	})
+	flags := flagSettings(visited)
+	path := configPath(runtime.GOOS, os.Getenv)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		fail(errOutput, &exitError{code: exitUsage, err: err})
+	}
+	conf, err := resolveSettings(cfg, path, *profile, flags, builtin, os.Getenv)
+	if err != nil {
+		fail(errOutput, &exitError{code: exitUsage, err: err})
+	}
+	output := conf.output
+	rpcTimeout = conf.timeout
+
+	if flag.Arg(0) == "config" {
+		if flag.NArg() != 2 || flag.Arg(1) != "show" {
+			fail(output, usageErrorf("usage: config show"))
+		}
+		res := configShowResult{File: path, FileFound: cfg != nil, Profile: *profile, Settings: conf.values}
+		if err := render(os.Stdout, output, res); err != nil {
+			fail(output, err)
+		}
+		return
 	}
 
-	command := flag.Arg(0)
+	addr := conf.addr
+	if addr.network == "npipe" && runtime.GOOS != "windows" {
+		fail(output, usageErrorf("%s: named pipes are only supported on Windows", addr))
+	}
 
 	// Connect to gRPC server
-	// Note: On Windows, we might need "unix:" prefix explicitly if it's not handled by the dialer target parser correctly for relative paths,
-	// but generally "unix:path" works.
-	target := "unix:" + *socketPath
-	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	target, dialOpts := addr.dialTarget()
+	dialOpts = append(dialOpts,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(callInterceptor(retry, addr.String())),
+	)
+	if retry.enabled() {
+		dialOpts = append(dialOpts, grpc.WithConnectParams(retry.connectParams()))
+	}
+	conn, err := grpc.NewClient(target, dialOpts...)
 	if err != nil {
-		log.Fatalf("did not connect: %v", err)
+		fail(output, &exitError{code: exitUnreachable, err: fmt.Errorf("did not connect: %w", err)})
 	}
 	defer conn.Close()
 
 	client := NewConnectToolServiceClient(conn)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	switch flag.Arg(0) {
+	case "shell", "repl":
+		runShell(client, output, addr)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	res, cmdOutput, err := dispatch(ctx, client, output, flag.Args())
+	if err != nil {
+		if errors.Is(err, errUnknownCommand) && cmdOutput == outputText {
+			fmt.Fprintln(os.Stderr, err)
+			printUsage()
+			os.Exit(exitUsage)
+		}
+		fail(cmdOutput, unreachableError(err, addr.String()))
+	}
+	if res == nil {
+		// Watch modes render each sample themselves.
+		return
+	}
+	if err := render(os.Stdout, cmdOutput, res); err != nil {
+		fail(cmdOutput, err)
+	}
+	if op, ok := res.(operationResult); ok && !op.succeeded() {
+		os.Exit(exitFailed)
+	}
+}
+
+// errUnknownCommand is wrapped by dispatch when args names no command.
+var errUnknownCommand = errors.New("unknown command")
 
-	switch command {
+// dispatch runs the command in args, which is the command name followed by
+// its arguments. It returns the result to render and the output mode to
+// render it in, since command-level format flags may override the global
+// one. Each RPC is bounded by rpcTimeout through the client's interceptor;
+// watch modes and prompts run until ctx is cancelled. A nil result with a
+// nil error means the command has already rendered its output.
+func dispatch(ctx context.Context, client ConnectToolServiceClient, output string, args []string) (result, string, error) {
+	var res result
+	var err error
+	switch args[0] {
 	case "create":
-		createLobby(ctx, client)
+		res, err = createLobby(ctx, client)
 	case "join":
-		if len(flag.Args()) < 2 {
-			log.Fatal("Usage: join <lobby_id>")
+		if len(args) < 2 {
+			return nil, output, usageErrorf("usage: join <lobby_id>")
 		}
-		joinLobby(ctx, client, flag.Arg(1))
+		res, err = joinLobby(ctx, client, args[1])
+	case "join-friend":
+		joinFlags := flag.NewFlagSet("join-friend", flag.ContinueOnError)
+		yes := joinFlags.Bool("yes", false, "Join without asking for confirmation")
+		pos, parseErr := parseArgs(joinFlags, args[1:])
+		if parseErr != nil {
+			return nil, output, flagError(parseErr)
+		}
+		if len(pos) != 1 {
+			return nil, output, usageErrorf("usage: join-friend [--yes] <name-or-steam_id>")
+		}
+		res, err = joinFriend(ctx, client, pos[0], *yes)
 	case "leave":
-		leaveLobby(ctx, client)
+		res, err = leaveLobby(ctx, client)
 	case "info":
-		getLobbyInfo(ctx, client)
+		infoFlags := flag.NewFlagSet("info", flag.ContinueOnError)
+		var opts infoOptions
+		infoFlags.BoolVar(&opts.memberNamesOnly, "member-names-only", false, "Print one member name per line")
+		infoFlags.StringVar(&opts.format, "format", "", "Output format: text, brief, json, compact-json or dot")
+		infoFlags.StringVar(&opts.format, "output", "", "Alias for --format")
+		watchOpts := addWatchFlags(infoFlags)
+		if err := infoFlags.Parse(args[1:]); err != nil {
+			return nil, output, flagError(err)
+		}
+		switch opts.format {
+		case "", "text", "brief", "json", "compact-json", "dot":
+		default:
+			return nil, output, usageErrorf("unknown --format %q (want text, brief, json, compact-json or dot)", opts.format)
+		}
+		output = overrideOutput(output, opts.format)
+		if watchOpts.enabled {
+			err = watchLobbyInfo(ctx, client, output, opts, watchOpts.interval)
+			break
+		}
+		res, err = getLobbyInfo(ctx, client, opts)
 	case "friends":
-		getFriendLobbies(ctx, client)
+		res, err = getFriendLobbies(ctx, client)
+	case "lobby-friends-in-lobby", "friends-in-lobby":
+		res, err = getFriendsInLobby(ctx, client)
 	case "invite":
-		if len(flag.Args()) < 2 {
-			log.Fatal("Usage: invite <steam_id>")
+		if len(args) < 2 {
+			return nil, output, usageErrorf("usage: invite <name-or-steam_id>")
 		}
-		inviteFriend(ctx, client, flag.Arg(1))
+		res, err = inviteFriend(ctx, client, args[1])
 
 	case "version":
-		getVersion(ctx, client)
+		res, err = getVersion(ctx, client)
 	case "vpn-status":
-		getVPNStatus(ctx, client)
+		statusFlags := flag.NewFlagSet("vpn-status", flag.ContinueOnError)
+		format := statusFlags.String("output", "", "Output format: text, json or env")
+		watchOpts := addWatchFlags(statusFlags)
+		if err := statusFlags.Parse(args[1:]); err != nil {
+			return nil, output, flagError(err)
+		}
+		switch *format {
+		case "", "text", "json", "env":
+		default:
+			return nil, output, usageErrorf("unknown --output %q (want text, json or env)", *format)
+		}
+		output = overrideOutput(output, *format)
+		if watchOpts.enabled {
+			err = watchVPNStatus(ctx, client, output, *format == "env", watchOpts.interval)
+			break
+		}
+		res, err = getVPNStatus(ctx, client, *format == "env")
 	case "vpn-routes":
-		getVPNRoutingTable(ctx, client)
+		routesFlags := flag.NewFlagSet("vpn-routes", flag.ContinueOnError)
+		var opts routeListOptions
+		routesFlags.BoolVar(&opts.count, "count", false, "Print only the number of routes")
+		routesFlags.StringVar(&opts.format, "format", "", "Output format: text, json or json-stream")
+		ipPrefix := routesFlags.String("ip-prefix", "", "Only show routes whose IP is within this CIDR")
+		if err := routesFlags.Parse(args[1:]); err != nil {
+			return nil, output, flagError(err)
+		}
+		switch opts.format {
+		case "", "text", "json", "json-stream":
+		default:
+			return nil, output, usageErrorf("unknown --format %q (want text, json or json-stream)", opts.format)
+		}
+		if *ipPrefix != "" {
+			_, ipNet, err := net.ParseCIDR(*ipPrefix)
+			if err != nil {
+				return nil, output, usageErrorf("invalid --ip-prefix: %w", err)
+			}
+			opts.prefix = ipNet
+		}
+		output = overrideOutput(output, opts.format)
+		res, err = getVPNRoutingTable(ctx, client, opts)
+	case "diag":
+		res, err = diagnose(ctx, client)
 	default:
-		fmt.Printf("Unknown command: %s\n", command)
-		printUsage()
-		os.Exit(1)
+		return nil, output, &exitError{code: exitUsage, err: fmt.Errorf("%w: %s", errUnknownCommand, args[0])}
 	}
+	return res, output, err
 }
 
+// parseArgs parses fs from args, allowing flags to follow positional
+// arguments, and returns the positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// rpcTimeout bounds each RPC attempt, set by --timeout or the config. callInterceptor
+// applies it, so callers only pass the context that cancels the command.
+var rpcTimeout = 5 * time.Second
+
 func defaultSocketPath() string {
 	if runtime.GOOS == "windows" {
 		return "connect_tool.sock"
@@ -80,116 +281,522 @@ func defaultSocketPath() string {
 }
 
 func printUsage() {
-	fmt.Println("Usage: connecttoolcli [flags] <command> [args...]")
-	fmt.Println("Commands:")
-	fmt.Println("  version                  Get server version")
-	fmt.Println("  create                   Create a new lobby")
-	fmt.Println("  join <lobby_id>          Join a lobby")
-	fmt.Println("  leave                    Leave current lobby")
-	fmt.Println("  info                     Get current lobby info")
-	fmt.Println("  friends                  List friend lobbies")
-	fmt.Println("  invite <steam_id>        Invite a friend")
-
-	fmt.Println("  vpn-status               Get VPN status")
-	fmt.Println("  vpn-routes               Get VPN routing table")
-	fmt.Println("Flags:")
+	w := flag.CommandLine.Output()
+	fmt.Fprintln(w, "Usage: connecttoolcli [flags] <command> [args...]")
+	fmt.Fprintln(w, "Commands:")
+	writeCommands(w)
+	fmt.Fprintln(w, "  shell                    Run commands interactively over one connection")
+	fmt.Fprintln(w, "  config show              Print the effective settings and where each came from")
+	fmt.Fprintln(w, "Flags:")
 	flag.PrintDefaults()
+	if path := configPath(runtime.GOOS, os.Getenv); path != "" {
+		fmt.Fprintf(w, "Config file: %s (see config show)\n", path)
+	}
+	fmt.Fprintln(w, "Exit codes:")
+	fmt.Fprintln(w, "  0  success")
+	fmt.Fprintln(w, "  1  usage error")
+	fmt.Fprintln(w, "  2  ConnectTool daemon unreachable (after --wait/--retry, if set)")
+	fmt.Fprintln(w, "  3  operation failed (e.g. join rejected, not in a lobby, diag found problems)")
 }
 
-func createLobby(ctx context.Context, client ConnectToolServiceClient) {
+// writeCommands lists the commands dispatch understands.
+func writeCommands(w io.Writer) {
+	fmt.Fprintln(w, "  version                  Get server version")
+	fmt.Fprintln(w, "  create                   Create a new lobby")
+	fmt.Fprintln(w, "  join <lobby_id>          Join a lobby")
+	fmt.Fprintln(w, "  join-friend [--yes] <name-or-steam_id>")
+	fmt.Fprintln(w, "                           Join the lobby a friend is in")
+	fmt.Fprintln(w, "  leave                    Leave current lobby")
+	fmt.Fprintln(w, "  info [--member-names-only] [--format text|brief|json|compact-json|dot]")
+	fmt.Fprintln(w, "       [--watch [--interval 2s]]")
+	fmt.Fprintln(w, "                           Get current lobby info")
+	fmt.Fprintln(w, "  friends                  List friend lobbies")
+	fmt.Fprintln(w, "  lobby-friends-in-lobby   List friends in the current lobby (alias friends-in-lobby)")
+	fmt.Fprintln(w, "  invite <name-or-steam_id>")
+	fmt.Fprintln(w, "                           Invite a friend (names resolve via friend lobbies)")
+
+	fmt.Fprintln(w, "  vpn-status [--output text|json|env] [--watch [--interval 2s]]")
+	fmt.Fprintln(w, "                           Get VPN status")
+	fmt.Fprintln(w, "  vpn-routes [--ip-prefix <cidr>] [--count] [--format text|json|json-stream]")
+	fmt.Fprintln(w, "                           Get VPN routing table")
+	fmt.Fprintln(w, "  diag                     Check lobby members against VPN routes")
+}
+
+type createResult struct {
+	Success bool   `json:"success"`
+	LobbyID string `json:"lobby_id"`
+}
+
+func (r createResult) writeText(w io.Writer) {
+	fmt.Fprintf(w, "Success: %v\n", r.Success)
+}
+
+func (r createResult) succeeded() bool { return r.Success }
+
+func createLobby(ctx context.Context, client ConnectToolServiceClient) (result, error) {
 	r, err := client.CreateLobby(ctx, &CreateLobbyRequest{})
 	if err != nil {
-		log.Fatalf("could not create lobby: %v", err)
+		return nil, fmt.Errorf("could not create lobby: %w", err)
 	}
-	fmt.Printf("Success: %v\n", r.GetSuccess())
+	return createResult{Success: r.GetSuccess(), LobbyID: r.GetLobbyId()}, nil
+}
+
+type joinResult struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+func (r joinResult) writeText(w io.Writer) {
+	fmt.Fprintf(w, "Success: %v, Message: %s\n", r.Success, r.Message)
 }
 
-func joinLobby(ctx context.Context, client ConnectToolServiceClient, lobbyID string) {
+func (r joinResult) succeeded() bool { return r.Success }
+
+func joinLobby(ctx context.Context, client ConnectToolServiceClient, lobbyID string) (result, error) {
 	r, err := client.JoinLobby(ctx, &JoinLobbyRequest{LobbyId: lobbyID})
 	if err != nil {
-		log.Fatalf("could not join lobby: %v", err)
+		return nil, fmt.Errorf("could not join lobby: %w", err)
 	}
-	fmt.Printf("Success: %v, Message: %s\n", r.GetSuccess(), r.GetMessage())
+	return joinResult{Success: r.GetSuccess(), Message: r.GetMessage()}, nil
+}
+
+type successResult struct {
+	Success bool `json:"success"`
+}
+
+func (r successResult) writeText(w io.Writer) {
+	fmt.Fprintf(w, "Success: %v\n", r.Success)
 }
 
-func leaveLobby(ctx context.Context, client ConnectToolServiceClient) {
+func (r successResult) succeeded() bool { return r.Success }
+
+func leaveLobby(ctx context.Context, client ConnectToolServiceClient) (result, error) {
 	r, err := client.LeaveLobby(ctx, &LeaveLobbyRequest{})
 	if err != nil {
-		log.Fatalf("could not leave lobby: %v", err)
+		return nil, fmt.Errorf("could not leave lobby: %w", err)
 	}
-	fmt.Printf("Success: %v\n", r.GetSuccess())
+	return successResult{Success: r.GetSuccess()}, nil
+}
+
+// infoOptions holds the info output flags.
+type infoOptions struct {
+	memberNamesOnly bool
+	format          string
+}
+
+type lobbyMemberJSON struct {
+	Name      string `json:"name"`
+	SteamID   string `json:"steam_id"`
+	Ping      int32  `json:"ping"`
+	RelayInfo string `json:"relay_info"`
 }
 
-func getLobbyInfo(ctx context.Context, client ConnectToolServiceClient) {
+func newLobbyMemberJSON(m *LobbyMember) lobbyMemberJSON {
+	return lobbyMemberJSON{
+		Name:      m.GetName(),
+		SteamID:   m.GetSteamId(),
+		Ping:      m.GetPing(),
+		RelayInfo: m.GetRelayInfo(),
+	}
+}
+
+type lobbyInfoResult struct {
+	InLobby bool              `json:"in_lobby"`
+	LobbyID string            `json:"lobby_id,omitempty"`
+	Members []lobbyMemberJSON `json:"members"`
+
+	format string // text rendering: text, brief or dot
+}
+
+func (r lobbyInfoResult) writeText(w io.Writer) {
+	switch r.format {
+	case "brief":
+		fmt.Fprintln(w, briefLobbyInfo(r))
+		return
+	case "dot":
+		io.WriteString(w, lobbyDOT(r))
+		return
+	}
+	fmt.Fprintf(w, "In Lobby: %v\n", r.InLobby)
+	if r.InLobby {
+		fmt.Fprintf(w, "Lobby ID: %s\n", r.LobbyID)
+		fmt.Fprintln(w, "Members:")
+		for _, m := range r.Members {
+			fmt.Fprintf(w, "  - Name: %s, ID: %s, Ping: %d, Relay: %s\n", m.Name, m.SteamID, m.Ping, m.RelayInfo)
+		}
+	}
+}
+
+type memberNamesResult struct {
+	Names []string `json:"names"`
+}
+
+func (r memberNamesResult) writeText(w io.Writer) {
+	for _, name := range r.Names {
+		fmt.Fprintln(w, name)
+	}
+}
+
+func getLobbyInfo(ctx context.Context, client ConnectToolServiceClient, opts infoOptions) (result, error) {
 	r, err := client.GetLobbyInfo(ctx, &GetLobbyInfoRequest{})
 	if err != nil {
-		log.Fatalf("could not get lobby info: %v", err)
+		return nil, fmt.Errorf("could not get lobby info: %w", err)
 	}
-	fmt.Printf("In Lobby: %v\n", r.GetIsInLobby())
-	if r.GetIsInLobby() {
-		fmt.Printf("Lobby ID: %s\n", r.GetLobbyId())
-		fmt.Println("Members:")
+	if opts.memberNamesOnly {
+		if !r.GetIsInLobby() {
+			return nil, errNotInLobby
+		}
+		names := memberNamesResult{Names: []string{}}
 		for _, m := range r.GetMembers() {
-			fmt.Printf("  - Name: %s, ID: %s, Ping: %d, Relay: %s\n", m.GetName(), m.GetSteamId(), m.GetPing(), m.GetRelayInfo())
+			names.Names = append(names.Names, m.GetName())
+		}
+		return names, nil
+	}
+	info := lobbyInfoResult{
+		InLobby: r.GetIsInLobby(),
+		LobbyID: r.GetLobbyId(),
+		Members: []lobbyMemberJSON{},
+		format:  opts.format,
+	}
+	for _, m := range r.GetMembers() {
+		info.Members = append(info.Members, newLobbyMemberJSON(m))
+	}
+	return info, nil
+}
+
+// briefLobbyInfo renders a single-line summary suitable for status bars,
+// e.g. "Lobby 12345 | 4 members | ping_avg: 45ms".
+func briefLobbyInfo(r lobbyInfoResult) string {
+	if !r.InLobby {
+		return "Not in lobby"
+	}
+	line := fmt.Sprintf("Lobby %s | %d members", r.LobbyID, len(r.Members))
+	if len(r.Members) > 0 {
+		var total int
+		for _, m := range r.Members {
+			total += int(m.Ping)
 		}
+		line += fmt.Sprintf(" | ping_avg: %dms", total/len(r.Members))
+	}
+	return line
+}
+
+// lobbyDOT renders the relay topology as a Graphviz digraph: one node per
+// member labelled with its ping, and an edge to a node for each distinct
+// relay the daemon reports. Pipe it to "dot -Tpng" to draw it.
+func lobbyDOT(r lobbyInfoResult) string {
+	var b strings.Builder
+	b.WriteString("digraph lobby {\n")
+	if r.InLobby {
+		fmt.Fprintf(&b, "  label=%s;\n", dotQuote("Lobby "+r.LobbyID))
+	}
+	b.WriteString("  node [shape=ellipse];\n")
+	relays := make(map[string]bool)
+	for _, m := range r.Members {
+		label := fmt.Sprintf("%s\\n%d ms", dotEscape(m.Name), m.Ping)
+		fmt.Fprintf(&b, "  %s [label=\"%s\"];\n", dotQuote(m.SteamID), label)
+		if relay := m.RelayInfo; relay != "" {
+			if !relays[relay] {
+				relays[relay] = true
+				fmt.Fprintf(&b, "  %s [shape=box, label=%s];\n", dotQuote("relay:"+relay), dotQuote(relay))
+			}
+			fmt.Fprintf(&b, "  %s -> %s;\n", dotQuote(m.SteamID), dotQuote("relay:"+relay))
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func dotQuote(s string) string {
+	return `"` + dotEscape(s) + `"`
+}
+
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+type friendLobbyJSON struct {
+	Name    string `json:"name"`
+	SteamID string `json:"steam_id"`
+	LobbyID string `json:"lobby_id"`
+}
+
+type friendLobbiesResult struct {
+	Lobbies []friendLobbyJSON `json:"lobbies"`
+}
+
+func (r friendLobbiesResult) writeText(w io.Writer) {
+	fmt.Fprintln(w, "Friend Lobbies:")
+	for _, l := range r.Lobbies {
+		fmt.Fprintf(w, "  - Friend: %s (%s), Lobby: %s\n", l.Name, l.SteamID, l.LobbyID)
 	}
 }
 
-func getFriendLobbies(ctx context.Context, client ConnectToolServiceClient) {
+func getFriendLobbies(ctx context.Context, client ConnectToolServiceClient) (result, error) {
 	r, err := client.GetFriendLobbies(ctx, &GetFriendLobbiesRequest{})
 	if err != nil {
-		log.Fatalf("could not get friend lobbies: %v", err)
+		return nil, fmt.Errorf("could not get friend lobbies: %w", err)
 	}
-	fmt.Println("Friend Lobbies:")
+	lobbies := friendLobbiesResult{Lobbies: []friendLobbyJSON{}}
 	for _, l := range r.GetLobbies() {
-		fmt.Printf("  - Friend: %s (%s), Lobby: %s\n", l.GetName(), l.GetSteamId(), l.GetLobbyId())
+		lobbies.Lobbies = append(lobbies.Lobbies, friendLobbyJSON{Name: l.GetName(), SteamID: l.GetSteamId(), LobbyID: l.GetLobbyId()})
+	}
+	return lobbies, nil
+}
+
+type friendsInLobbyResult struct {
+	InLobby bool              `json:"in_lobby"`
+	Members []lobbyMemberJSON `json:"members"`
+}
+
+func (r friendsInLobbyResult) writeText(w io.Writer) {
+	if !r.InLobby {
+		fmt.Fprintln(w, "In Lobby: false")
+		return
+	}
+	fmt.Fprintln(w, "Friends in Lobby:")
+	for _, m := range r.Members {
+		fmt.Fprintf(w, "  - Name: %s, ID: %s, Ping: %d, Relay: %s\n", m.Name, m.SteamID, m.Ping, m.RelayInfo)
+	}
+}
+
+func getFriendsInLobby(ctx context.Context, client ConnectToolServiceClient) (result, error) {
+	info, err := client.GetLobbyInfo(ctx, &GetLobbyInfoRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("could not get lobby info: %w", err)
+	}
+	res := friendsInLobbyResult{InLobby: info.GetIsInLobby(), Members: []lobbyMemberJSON{}}
+	if !res.InLobby {
+		return res, nil
+	}
+	friends, err := client.GetFriendLobbies(ctx, &GetFriendLobbiesRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("could not get friend lobbies: %w", err)
+	}
+	// GetFriendLobbies lists every friend currently in a lobby, which is
+	// a superset of the friends in ours.
+	isFriend := make(map[string]bool)
+	for _, l := range friends.GetLobbies() {
+		isFriend[l.GetSteamId()] = true
 	}
+	for _, m := range info.GetMembers() {
+		if isFriend[m.GetSteamId()] {
+			res.Members = append(res.Members, newLobbyMemberJSON(m))
+		}
+	}
+	return res, nil
 }
 
-func inviteFriend(ctx context.Context, client ConnectToolServiceClient, friendID string) {
+func inviteFriend(ctx context.Context, client ConnectToolServiceClient, friend string) (result, error) {
+	friendID := friend
+	if !isSteamID(friend) {
+		// Names can only be resolved against friends currently in a lobby.
+		l, err := findFriend(ctx, client, friend)
+		if err != nil {
+			return nil, err
+		}
+		friendID = l.GetSteamId()
+	}
 	r, err := client.InviteFriend(ctx, &InviteFriendRequest{FriendSteamId: friendID})
 	if err != nil {
-		log.Fatalf("could not invite friend: %v", err)
+		return nil, fmt.Errorf("could not invite friend: %w", err)
 	}
-	fmt.Printf("Success: %v\n", r.GetSuccess())
+	return successResult{Success: r.GetSuccess()}, nil
+}
+
+type versionResult struct {
+	Version string `json:"version"`
 }
 
-func getVersion(ctx context.Context, client ConnectToolServiceClient) {
+func (r versionResult) writeText(w io.Writer) {
+	fmt.Fprintf(w, "Version: %s\n", r.Version)
+}
+
+func getVersion(ctx context.Context, client ConnectToolServiceClient) (result, error) {
 	r, err := client.GetVersion(ctx, &GetVersionRequest{})
 	if err != nil {
-		log.Fatalf("could not get version: %v", err)
+		return nil, fmt.Errorf("could not get version: %w", err)
 	}
-	fmt.Printf("Version: %s\n", r.GetVersion())
+	return versionResult{Version: r.GetVersion()}, nil
 }
 
-func getVPNStatus(ctx context.Context, client ConnectToolServiceClient) {
+type vpnStatsJSON struct {
+	PacketsSent     uint64 `json:"packets_sent"`
+	BytesSent       uint64 `json:"bytes_sent"`
+	PacketsReceived uint64 `json:"packets_received"`
+	BytesReceived   uint64 `json:"bytes_received"`
+	PacketsDropped  uint64 `json:"packets_dropped"`
+}
+
+type vpnStatusResult struct {
+	Enabled    bool          `json:"enabled"`
+	LocalIP    string        `json:"local_ip"`
+	DeviceName string        `json:"device_name"`
+	Stats      *vpnStatsJSON `json:"stats,omitempty"`
+	Rates      *vpnRatesJSON `json:"rates,omitempty"` // set by vpn-status --watch
+
+	env bool // render as shell variables instead of text
+}
+
+func (r vpnStatusResult) writeText(w io.Writer) {
+	if r.env {
+		writeVPNStatusEnv(w, r)
+		return
+	}
+	fmt.Fprintf(w, "Enabled: %v\n", r.Enabled)
+	if r.Enabled {
+		fmt.Fprintf(w, "Local IP: %s\n", r.LocalIP)
+		fmt.Fprintf(w, "Device: %s\n", r.DeviceName)
+		if stats := r.Stats; stats != nil {
+			fmt.Fprintln(w, "Stats:")
+			fmt.Fprintf(w, "  Sent: %d pkts / %d bytes\n", stats.PacketsSent, stats.BytesSent)
+			fmt.Fprintf(w, "  Recv: %d pkts / %d bytes\n", stats.PacketsReceived, stats.BytesReceived)
+			fmt.Fprintf(w, "  Dropped: %d pkts\n", stats.PacketsDropped)
+		}
+		if rates := r.Rates; rates != nil {
+			fmt.Fprintln(w, "Rates:")
+			fmt.Fprintf(w, "  Sent: %.1f pkts/s / %s\n", rates.PacketsSentPerSec, formatByteRate(rates.BytesSentPerSec))
+			fmt.Fprintf(w, "  Recv: %.1f pkts/s / %s\n", rates.PacketsReceivedPerSec, formatByteRate(rates.BytesReceivedPerSec))
+		}
+	}
+}
+
+func getVPNStatus(ctx context.Context, client ConnectToolServiceClient, env bool) (result, error) {
 	r, err := client.GetVPNStatus(ctx, &GetVPNStatusRequest{})
 	if err != nil {
-		log.Fatalf("could not get VPN status: %v", err)
+		return nil, fmt.Errorf("could not get VPN status: %w", err)
+	}
+	status := vpnStatusResult{
+		Enabled:    r.GetEnabled(),
+		LocalIP:    r.GetLocalIp(),
+		DeviceName: r.GetDeviceName(),
+		env:        env,
+	}
+	if stats := r.GetStats(); stats != nil {
+		status.Stats = &vpnStatsJSON{
+			PacketsSent:     stats.GetPacketsSent(),
+			BytesSent:       stats.GetBytesSent(),
+			PacketsReceived: stats.GetPacketsReceived(),
+			BytesReceived:   stats.GetBytesReceived(),
+			PacketsDropped:  stats.GetPacketsDropped(),
+		}
 	}
-	fmt.Printf("Enabled: %v\n", r.GetEnabled())
-	if r.GetEnabled() {
-		fmt.Printf("Local IP: %s\n", r.GetLocalIp())
-		fmt.Printf("Device: %s\n", r.GetDeviceName())
-		stats := r.GetStats()
-		if stats != nil {
-			fmt.Println("Stats:")
-			fmt.Printf("  Sent: %d pkts / %d bytes\n", stats.GetPacketsSent(), stats.GetBytesSent())
-			fmt.Printf("  Recv: %d pkts / %d bytes\n", stats.GetPacketsReceived(), stats.GetBytesReceived())
-			fmt.Printf("  Dropped: %d pkts\n", stats.GetPacketsDropped())
+	return status, nil
+}
+
+// writeVPNStatusEnv writes the status as KEY=value lines that can be
+// loaded with eval "$(connecttoolcli vpn-status --output env)".
+func writeVPNStatusEnv(w io.Writer, r vpnStatusResult) {
+	var stats vpnStatsJSON
+	if r.Stats != nil {
+		stats = *r.Stats
+	}
+	vars := []struct {
+		key, value string
+	}{
+		{"VPN_ENABLED", strconv.FormatBool(r.Enabled)},
+		{"VPN_LOCAL_IP", r.LocalIP},
+		{"VPN_DEVICE_NAME", r.DeviceName},
+		{"VPN_PACKETS_SENT", strconv.FormatUint(stats.PacketsSent, 10)},
+		{"VPN_BYTES_SENT", strconv.FormatUint(stats.BytesSent, 10)},
+		{"VPN_PACKETS_RECEIVED", strconv.FormatUint(stats.PacketsReceived, 10)},
+		{"VPN_BYTES_RECEIVED", strconv.FormatUint(stats.BytesReceived, 10)},
+		{"VPN_PACKETS_DROPPED", strconv.FormatUint(stats.PacketsDropped, 10)},
+	}
+	for _, v := range vars {
+		fmt.Fprintf(w, "%s=%s\n", v.key, shellQuote(v.value))
+	}
+}
+
+// shellQuote returns s unchanged if it is safe as a bare POSIX shell word,
+// otherwise wrapped in single quotes.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("_-.,:/@%+=", c)) {
+			safe = false
+			break
 		}
 	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// routeListOptions holds the vpn-routes filter and output flags.
+type routeListOptions struct {
+	prefix *net.IPNet
+	count  bool
+	format string
 }
 
-func getVPNRoutingTable(ctx context.Context, client ConnectToolServiceClient) {
+type routeJSON struct {
+	IP      string `json:"ip"`
+	Name    string `json:"name"`
+	IsLocal bool   `json:"is_local"`
+}
+
+func newRouteJSON(route *VPNRoute) routeJSON {
+	return routeJSON{
+		IP:      routeIP(route).String(),
+		Name:    route.GetName(),
+		IsLocal: route.GetIsLocal(),
+	}
+}
+
+type routingTableResult struct {
+	Routes []routeJSON `json:"routes"`
+
+	stream bool // render as NDJSON, one route per line
+}
+
+func (r routingTableResult) writeText(w io.Writer) {
+	if r.stream {
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		for _, route := range r.Routes {
+			enc.Encode(route)
+		}
+		return
+	}
+	fmt.Fprintln(w, "Routing Table:")
+	for _, route := range r.Routes {
+		fmt.Fprintf(w, "  - IP: %s, Name: %s, Local: %v\n", route.IP, route.Name, route.IsLocal)
+	}
+}
+
+type countResult struct {
+	Count int `json:"count"`
+}
+
+func (r countResult) writeText(w io.Writer) {
+	fmt.Fprintln(w, r.Count)
+}
+
+func getVPNRoutingTable(ctx context.Context, client ConnectToolServiceClient, opts routeListOptions) (result, error) {
 	r, err := client.GetVPNRoutingTable(ctx, &GetVPNRoutingTableRequest{})
 	if err != nil {
-		log.Fatalf("could not get VPN routing table: %v", err)
+		return nil, fmt.Errorf("could not get VPN routing table: %w", err)
 	}
-	fmt.Println("Routing Table:")
+	table := routingTableResult{Routes: []routeJSON{}, stream: opts.format == "json-stream"}
 	for _, route := range r.GetRoutes() {
-		// Convert uint32 IP to string
-		ip := fmt.Sprintf("%d.%d.%d.%d", byte(route.GetIp()>>24), byte(route.GetIp()>>16), byte(route.GetIp()>>8), byte(route.GetIp()))
-		fmt.Printf("  - IP: %s, Name: %s, Local: %v\n", ip, route.GetName(), route.GetIsLocal())
+		if opts.prefix != nil && !opts.prefix.Contains(routeIP(route)) {
+			continue
+		}
+		table.Routes = append(table.Routes, newRouteJSON(route))
+	}
+	if opts.count {
+		return countResult{Count: len(table.Routes)}, nil
 	}
+	return table, nil
+}
+
+// routeIP converts the route's big-endian uint32 address to a net.IP.
+func routeIP(route *VPNRoute) net.IP {
+	v := route.GetIp()
+	return net.IPv4(byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
 }
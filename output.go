@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Output modes. The global --output flag accepts text and json;
+// compact-json is selected through command-level flags such as
+// info --format compact-json.
+const (
+	outputText        = "text"
+	outputJSON        = "json"
+	outputCompactJSON = "compact-json"
+)
+
+// A result is what a command handler returns on success. In JSON modes it
+// is marshalled as-is, so only its exported fields are part of the output;
+// in text mode writeText renders it for humans.
+type result interface {
+	writeText(w io.Writer)
+}
+
+type errorResult struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
+}
+
+// overrideOutput applies a command-level format flag on top of the global
+// output mode. An empty format keeps the global mode, the JSON formats
+// select JSON, and anything else is a text rendering chosen by the command.
+func overrideOutput(output, format string) string {
+	switch format {
+	case "":
+		return output
+	case outputJSON, outputCompactJSON:
+		return format
+	default:
+		return outputText
+	}
+}
+
+func render(w io.Writer, output string, res result) error {
+	switch output {
+	case outputJSON, outputCompactJSON:
+		return writeJSON(w, res, output == outputJSON)
+	default:
+		res.writeText(w)
+		return nil
+	}
+}
+
+func writeJSON(w io.Writer, v any, indent bool) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if indent {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("could not encode output: %w", err)
+	}
+	return nil
+}
+
+// fail reports err in the given output mode and exits with its exit code.
+// Text mode writes to stderr so errors never pollute parsed output; JSON
+// modes write the error document to stdout so scripts only need to parse
+// one stream.
+func fail(output string, err error) {
+	reportError(output, err)
+	os.Exit(exitCode(err))
+}
+
+// reportError writes err the way fail does, without exiting.
+func reportError(output string, err error) {
+	if exitCode(err) == exitOK {
+		// flag.ErrHelp: the flag set has already printed its usage.
+		return
+	}
+	if output == outputText {
+		var e *exitError
+		if !errors.As(err, &e) || !e.reported {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	} else {
+		writeJSON(os.Stdout, errorResult{Error: err.Error()}, output == outputJSON)
+	}
+}
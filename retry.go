@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Retry backoff bounds. The first retry waits retryBaseDelay and each one
+// after that doubles it, up to retryMaxDelay.
+const (
+	retryBaseDelay = 200 * time.Millisecond
+	retryMaxDelay  = 2 * time.Second
+)
+
+// retryPolicy says how long to keep retrying RPCs that fail because the
+// daemon is not reachable yet, as set by --wait and --retry. With both
+// zero nothing is retried; with both set, whichever runs out first wins.
+type retryPolicy struct {
+	wait    time.Duration // total time to keep retrying; 0 is no limit
+	retries int           // attempts after the first; 0 is no limit
+}
+
+func (p retryPolicy) enabled() bool { return p.wait > 0 || p.retries > 0 }
+
+// connectParams makes grpc redial as eagerly as we retry. Without it the
+// channel backs off for a second or more after a refused connection and
+// fails our retries from its cache in the meantime.
+func (p retryPolicy) connectParams() grpc.ConnectParams {
+	return grpc.ConnectParams{
+		Backoff: backoff.Config{
+			BaseDelay:  retryBaseDelay,
+			Multiplier: 2,
+			Jitter:     0.2,
+			MaxDelay:   retryMaxDelay,
+		},
+		MinConnectTimeout: rpcTimeout,
+	}
+}
+
+// callInterceptor bounds each attempt of a unary RPC by rpcTimeout. If the
+// policy is enabled, attempts failing with Unavailable, which is how a
+// missing socket or refused connection shows up, are retried with
+// exponential backoff. Other errors, including application failures the
+// daemon reports, are returned at once. The first retry prints one
+// "waiting for" line naming target to stderr.
+func callInterceptor(policy retryPolicy, target string) grpc.UnaryClientInterceptor {
+	var announce sync.Once
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		var deadline time.Time
+		if policy.wait > 0 {
+			deadline = time.Now().Add(policy.wait)
+		}
+		delay := retryBaseDelay
+		for attempt := 1; ; attempt++ {
+			attemptCtx, cancel := context.WithTimeout(ctx, rpcTimeout)
+			err := invoker(attemptCtx, method, req, reply, cc, opts...)
+			cancel()
+			if err == nil || !policy.enabled() || status.Code(err) != codes.Unavailable {
+				return err
+			}
+			if policy.retries > 0 && attempt > policy.retries {
+				return err
+			}
+			sleep := delay
+			if !deadline.IsZero() {
+				remaining := time.Until(deadline)
+				if remaining <= 0 {
+					return err
+				}
+				sleep = min(sleep, remaining)
+			}
+			announce.Do(func() {
+				fmt.Fprintf(os.Stderr, "waiting for ConnectTool daemon at %s...\n", target)
+			})
+			timer := time.NewTimer(sleep)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+			delay = min(delay*2, retryMaxDelay)
+		}
+	}
+}
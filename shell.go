@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+)
+
+const shellPrompt = "connecttool> "
+
+// stdinLines delivers lines read from stdin and is closed at EOF. The shell
+// and confirmation prompts share it so only one goroutine ever reads stdin.
+var stdinLines = sync.OnceValue(func() <-chan string {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	return lines
+})
+
+// runShell reads command lines from stdin and dispatches them over the one
+// client connection until EOF or exit. Errors are reported and the shell
+// carries on. Ctrl+C interrupts the running command, such as a --watch,
+// and returns to the prompt.
+func runShell(client ConnectToolServiceClient, output string, addr address) {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	lines := stdinLines()
+	for {
+		fmt.Fprint(os.Stderr, shellPrompt)
+		var line string
+		select {
+		case l, ok := <-lines:
+			if !ok {
+				fmt.Fprintln(os.Stderr)
+				return
+			}
+			line = l
+		case <-interrupts:
+			fmt.Fprintln(os.Stderr)
+			continue
+		}
+
+		args, err := splitArgs(line)
+		if err != nil {
+			reportError(output, usageErrorf("%v", err))
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		switch args[0] {
+		case "exit", "quit":
+			return
+		case "help":
+			writeShellCommands(os.Stdout)
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-interrupts:
+				cancel()
+			case <-done:
+			}
+		}()
+		runShellCommand(ctx, client, output, addr, args)
+		close(done)
+		cancel()
+	}
+}
+
+func runShellCommand(ctx context.Context, client ConnectToolServiceClient, output string, addr address, args []string) {
+	res, cmdOutput, err := dispatch(ctx, client, output, args)
+	switch {
+	case errors.Is(err, errUnknownCommand):
+		reportError(cmdOutput, err)
+		if cmdOutput == outputText {
+			writeShellCommands(os.Stderr)
+		}
+	case err != nil:
+		reportError(cmdOutput, unreachableError(err, addr.String()))
+	case res != nil:
+		if err := render(os.Stdout, cmdOutput, res); err != nil {
+			reportError(cmdOutput, err)
+		}
+	}
+}
+
+// writeShellCommands lists the commands the shell accepts.
+func writeShellCommands(w io.Writer) {
+	fmt.Fprintln(w, "Commands:")
+	writeCommands(w)
+	fmt.Fprintln(w, "  help                     Show this list")
+	fmt.Fprintln(w, "  exit                     Leave the shell (or Ctrl+D)")
+}
+
+// splitArgs splits a shell line into words. Single quotes preserve text
+// literally; double quotes allow backslash escapes; a backslash outside
+// quotes escapes the next character.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, c := range line {
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	switch {
+	case quote != 0:
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	case escaped:
+		return nil, errors.New("trailing backslash")
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"info", []string{"info"}},
+		{"  join   12345  ", []string{"join", "12345"}},
+		{"invite \"Alex Smith\"", []string{"invite", "Alex Smith"}},
+		{"invite 'Alex \"the\" Smith'", []string{"invite", `Alex "the" Smith`}},
+		{`invite "say \"hi\""`, []string{"invite", `say "hi"`}},
+		{`invite Alex\ Smith`, []string{"invite", "Alex Smith"}},
+		{`invite 'C:\pipe'`, []string{"invite", `C:\pipe`}},
+		{"join-friend --yes ''", []string{"join-friend", "--yes", ""}},
+		{"a\tb", []string{"a", "b"}},
+		{`pre"fix"ed`, []string{"prefixed"}},
+	}
+	for _, tt := range tests {
+		got, err := splitArgs(tt.in)
+		if err != nil {
+			t.Errorf("splitArgs(%q) error: %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplitArgsErrors(t *testing.T) {
+	for _, in := range []string{`invite "Alex`, `invite 'Alex`, `invite Alex\`} {
+		if got, err := splitArgs(in); err == nil {
+			t.Errorf("splitArgs(%q) = %q, want error", in, got)
+		}
+	}
+}
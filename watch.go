@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// clearScreen moves the cursor home and clears the terminal.
+const clearScreen = "\033[H\033[2J"
+
+// watchOptions holds the --watch and --interval flags shared by info and
+// vpn-status.
+type watchOptions struct {
+	enabled  bool
+	interval time.Duration
+}
+
+func addWatchFlags(fs *flag.FlagSet) *watchOptions {
+	var opts watchOptions
+	fs.BoolVar(&opts.enabled, "watch", false, "Re-poll and redraw until interrupted")
+	fs.DurationVar(&opts.interval, "interval", 2*time.Second, "Polling interval for --watch")
+	return &opts
+}
+
+// watch calls poll every interval and renders each sample to w until ctx is
+// cancelled, which is a clean exit. A failed poll prints a warning and the
+// watch carries on; a second failure in a row ends it with that error. In
+// JSON mode each sample is written as one compact line instead of redrawing
+// the screen.
+func watch(ctx context.Context, w io.Writer, interval time.Duration, output string, poll func(ctx context.Context) (result, error)) error {
+	if interval <= 0 {
+		return usageErrorf("--interval must be positive, got %s", interval)
+	}
+	if output == outputJSON {
+		output = outputCompactJSON
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	failed := false
+	for {
+		res, err := poll(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err != nil:
+			if failed {
+				return err
+			}
+			failed = true
+			fmt.Fprintf(os.Stderr, "warning: %v (retrying in %s)\n", err, interval)
+		default:
+			failed = false
+			if output == outputText {
+				io.WriteString(w, clearScreen)
+			}
+			if err := render(w, output, res); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// lobbyWatchResult is a lobby info sample annotated with what changed
+// since the previous one.
+type lobbyWatchResult struct {
+	lobbyInfoResult
+	Joined []lobbyMemberJSON `json:"joined,omitempty"`
+	Left   []lobbyMemberJSON `json:"left,omitempty"`
+
+	pingDelta map[string]int32 // by steam ID, for members in both samples
+}
+
+func (r lobbyWatchResult) writeText(w io.Writer) {
+	if (r.format != "" && r.format != "text") || !r.InLobby {
+		r.lobbyInfoResult.writeText(w)
+	} else {
+		fmt.Fprintf(w, "In Lobby: %v\n", r.InLobby)
+		fmt.Fprintf(w, "Lobby ID: %s\n", r.LobbyID)
+		fmt.Fprintln(w, "Members:")
+		for _, m := range r.Members {
+			ping := fmt.Sprint(m.Ping)
+			if d := r.pingDelta[m.SteamID]; d != 0 {
+				ping += fmt.Sprintf(" (%+d)", d)
+			}
+			fmt.Fprintf(w, "  - Name: %s, ID: %s, Ping: %s, Relay: %s\n", m.Name, m.SteamID, ping, m.RelayInfo)
+		}
+	}
+	for _, m := range r.Joined {
+		fmt.Fprintf(w, "+ %s (%s) joined\n", m.Name, m.SteamID)
+	}
+	for _, m := range r.Left {
+		fmt.Fprintf(w, "- %s (%s) left\n", m.Name, m.SteamID)
+	}
+}
+
+func watchLobbyInfo(ctx context.Context, client ConnectToolServiceClient, output string, opts infoOptions, interval time.Duration) error {
+	var prev *lobbyInfoResult
+	return watch(ctx, os.Stdout, interval, output, func(ctx context.Context) (result, error) {
+		res, err := getLobbyInfo(ctx, client, opts)
+		if err != nil {
+			return nil, err
+		}
+		info, ok := res.(lobbyInfoResult)
+		if !ok {
+			return res, nil
+		}
+		sample := diffLobby(prev, info)
+		prev = &info
+		return sample, nil
+	})
+}
+
+// diffLobby annotates info with what changed since prev, the previous
+// sample, which is nil for the first one. Joined follows info's member
+// order and Left follows prev's, so repeated runs print the same lines.
+func diffLobby(prev *lobbyInfoResult, info lobbyInfoResult) lobbyWatchResult {
+	sample := lobbyWatchResult{lobbyInfoResult: info, pingDelta: make(map[string]int32)}
+	if prev == nil {
+		return sample
+	}
+	before := make(map[string]lobbyMemberJSON)
+	for _, m := range prev.Members {
+		before[m.SteamID] = m
+	}
+	now := make(map[string]bool)
+	for _, m := range info.Members {
+		now[m.SteamID] = true
+		if p, seen := before[m.SteamID]; seen {
+			sample.pingDelta[m.SteamID] = m.Ping - p.Ping
+		} else {
+			sample.Joined = append(sample.Joined, m)
+		}
+	}
+	for _, m := range prev.Members {
+		if !now[m.SteamID] {
+			sample.Left = append(sample.Left, m)
+		}
+	}
+	return sample
+}
+
+type vpnRatesJSON struct {
+	PacketsSentPerSec     float64 `json:"packets_sent_per_sec"`
+	BytesSentPerSec       float64 `json:"bytes_sent_per_sec"`
+	PacketsReceivedPerSec float64 `json:"packets_received_per_sec"`
+	BytesReceivedPerSec   float64 `json:"bytes_received_per_sec"`
+}
+
+func watchVPNStatus(ctx context.Context, client ConnectToolServiceClient, output string, env bool, interval time.Duration) error {
+	var prev *vpnStatsJSON
+	var prevAt time.Time
+	return watch(ctx, os.Stdout, interval, output, func(ctx context.Context) (result, error) {
+		res, err := getVPNStatus(ctx, client, env)
+		if err != nil {
+			return nil, err
+		}
+		status := res.(vpnStatusResult)
+		now := time.Now()
+		if prev != nil && status.Stats != nil {
+			status.Rates = vpnRates(*prev, *status.Stats, now.Sub(prevAt))
+		}
+		prev, prevAt = status.Stats, now
+		return status, nil
+	})
+}
+
+// vpnRates computes per-second rates between two stats samples taken
+// elapsed apart. A counter that went backwards (daemon restart) counts as
+// zero.
+func vpnRates(prev, cur vpnStatsJSON, elapsed time.Duration) *vpnRatesJSON {
+	secs := elapsed.Seconds()
+	if secs <= 0 {
+		return nil
+	}
+	rate := func(prev, cur uint64) float64 {
+		if cur < prev {
+			return 0
+		}
+		return float64(cur-prev) / secs
+	}
+	return &vpnRatesJSON{
+		PacketsSentPerSec:     rate(prev.PacketsSent, cur.PacketsSent),
+		BytesSentPerSec:       rate(prev.BytesSent, cur.BytesSent),
+		PacketsReceivedPerSec: rate(prev.PacketsReceived, cur.PacketsReceived),
+		BytesReceivedPerSec:   rate(prev.BytesReceived, cur.BytesReceived),
+	}
+}
+
+// formatByteRate renders a byte rate as B/s, KB/s or MB/s.
+func formatByteRate(bps float64) string {
+	switch {
+	case bps >= 1024*1024:
+		return fmt.Sprintf("%.1f MB/s", bps/(1024*1024))
+	case bps >= 1024:
+		return fmt.Sprintf("%.1f KB/s", bps/1024)
+	default:
+		return fmt.Sprintf("%.0f B/s", bps)
+	}
+}
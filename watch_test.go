@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVPNRates(t *testing.T) {
+	prev := vpnStatsJSON{PacketsSent: 100, BytesSent: 1000, PacketsReceived: 50, BytesReceived: 4000}
+	cur := vpnStatsJSON{PacketsSent: 300, BytesSent: 5000, PacketsReceived: 60, BytesReceived: 8000}
+	got := vpnRates(prev, cur, 2*time.Second)
+	want := vpnRatesJSON{PacketsSentPerSec: 100, BytesSentPerSec: 2000, PacketsReceivedPerSec: 5, BytesReceivedPerSec: 2000}
+	if got == nil || *got != want {
+		t.Errorf("vpnRates = %+v, want %+v", got, want)
+	}
+}
+
+func TestVPNRatesCounterReset(t *testing.T) {
+	prev := vpnStatsJSON{PacketsSent: 500, BytesSent: 9000}
+	cur := vpnStatsJSON{PacketsSent: 10, BytesSent: 100}
+	got := vpnRates(prev, cur, time.Second)
+	if got == nil || got.PacketsSentPerSec != 0 || got.BytesSentPerSec != 0 {
+		t.Errorf("vpnRates after a counter reset = %+v, want zero rates", got)
+	}
+	if got := vpnRates(prev, cur, 0); got != nil {
+		t.Errorf("vpnRates with no elapsed time = %+v, want nil", got)
+	}
+}
+
+func TestFormatByteRate(t *testing.T) {
+	tests := []struct {
+		bps  float64
+		want string
+	}{
+		{0, "0 B/s"},
+		{1023, "1023 B/s"},
+		{1024, "1.0 KB/s"},
+		{1536, "1.5 KB/s"},
+		{1024 * 1024, "1.0 MB/s"},
+		{5.5 * 1024 * 1024, "5.5 MB/s"},
+	}
+	for _, tt := range tests {
+		if got := formatByteRate(tt.bps); got != tt.want {
+			t.Errorf("formatByteRate(%v) = %q, want %q", tt.bps, got, tt.want)
+		}
+	}
+}
+
+func TestDiffLobby(t *testing.T) {
+	prev := lobbyInfoResult{InLobby: true, Members: []lobbyMemberJSON{
+		{Name: "Me", SteamID: "1", Ping: 0},
+		{Name: "Alex", SteamID: "2", Ping: 40},
+		{Name: "Bo", SteamID: "3", Ping: 80},
+		{Name: "Cy", SteamID: "4", Ping: 90},
+	}}
+	cur := lobbyInfoResult{InLobby: true, Members: []lobbyMemberJSON{
+		{Name: "Me", SteamID: "1", Ping: 0},
+		{Name: "Alex", SteamID: "2", Ping: 45},
+		{Name: "Dee", SteamID: "5", Ping: 20},
+	}}
+
+	first := diffLobby(nil, prev)
+	if len(first.Joined) != 0 || len(first.Left) != 0 {
+		t.Errorf("first sample reported joined %v, left %v", first.Joined, first.Left)
+	}
+
+	sample := diffLobby(&prev, cur)
+	if len(sample.Joined) != 1 || sample.Joined[0].SteamID != "5" {
+		t.Errorf("joined = %v, want Dee", sample.Joined)
+	}
+	if len(sample.Left) != 2 || sample.Left[0].SteamID != "3" || sample.Left[1].SteamID != "4" {
+		t.Errorf("left = %v, want Bo then Cy", sample.Left)
+	}
+	if d := sample.pingDelta["2"]; d != 5 {
+		t.Errorf("Alex ping delta = %d, want +5", d)
+	}
+	if _, ok := sample.pingDelta["5"]; ok {
+		t.Error("a member who just joined should have no ping delta")
+	}
+}
+
+type emptyResult struct{}
+
+func (emptyResult) writeText(io.Writer) {}
+
+// scriptedPoll returns a poll function that fails where script is false
+// and counts its calls.
+func scriptedPoll(script []bool, calls *int) func(context.Context) (result, error) {
+	return func(context.Context) (result, error) {
+		ok := script[*calls]
+		*calls++
+		if !ok {
+			return nil, errors.New("poll failed")
+		}
+		return emptyResult{}, nil
+	}
+}
+
+func TestWatchSecondConsecutiveFailure(t *testing.T) {
+	calls := 0
+	poll := scriptedPoll([]bool{true, false, true, false, false, true}, &calls)
+	var out bytes.Buffer
+	err := watch(context.Background(), &out, time.Millisecond, outputJSON, poll)
+	if err == nil || err.Error() != "poll failed" {
+		t.Fatalf("watch error = %v, want the second consecutive failure", err)
+	}
+	if calls != 5 {
+		t.Errorf("watch polled %d times, want 5", calls)
+	}
+	if got := strings.Count(out.String(), "{}\n"); got != 2 {
+		t.Errorf("watch rendered %d samples, want 2 compact lines", got)
+	}
+}
+
+func TestWatchCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := watch(ctx, io.Discard, time.Millisecond, outputText, func(context.Context) (result, error) {
+		calls++
+		if calls == 3 {
+			cancel()
+		}
+		return emptyResult{}, nil
+	})
+	if err != nil {
+		t.Errorf("watch after cancel = %v, want nil", err)
+	}
+	if calls != 3 {
+		t.Errorf("watch polled %d times after cancel, want 3", calls)
+	}
+}